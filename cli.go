@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rutube/infrastructure/audit"
+	"rutube/infrastructure/config"
+	"rutube/infrastructure/database"
+	"rutube/infrastructure/server"
+	"rutube/infrastructure/spreadsheet"
+	"rutube/models"
+	"rutube/usecase"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func runCommand(ctx context.Context, logger *zap.Logger, cfg config.Config, args []string) error {
+	ctx = audit.WithActor(ctx, audit.ActorCLI)
+	switch args[0] {
+	case "import":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s import <file.csv|file.xlsx>", os.Args[0])
+		}
+		return importCommand(ctx, logger, cfg, args[1])
+	case "gencert":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: %s gencert <dir> [host...]", os.Args[0])
+		}
+		return gencertCommand(logger, args[1], args[2:])
+	case "backup":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: %s backup export|restore|snapshot <file>", os.Args[0])
+		}
+		return backupCommand(ctx, logger, cfg, args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// gencertCommand writes a self-signed certificate and key for local HTTPS
+// testing; point http.tls_cert_file and http.tls_key_file at them.
+func gencertCommand(logger *zap.Logger, dir string, hosts []string) error {
+	certPEM, keyPEM, err := server.GenerateSelfSigned(hosts, 365*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return err
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+
+	logger.Info("Certificate generated", zap.String("cert", certFile), zap.String("key", keyFile))
+	return nil
+}
+
+func openUseCase(logger *zap.Logger, cfg config.Config) (*usecase.UseCase, *database.Database, func(), error) {
+	db, err := database.InitDatabase(cfg.Database.Driver, cfg.Database.DSN, cfg.Database.Options())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dbService := database.NewDatabase(logger, db)
+	useCase := usecase.NewUseCase(logger, dbService, nil, usecase.Options{})
+	return useCase, dbService, func() { db.Close() }, nil
+}
+
+func importCommand(ctx context.Context, logger *zap.Logger, cfg config.Config, fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := spreadsheet.ReadRows(fileName, file)
+	if err != nil {
+		return err
+	}
+
+	useCase, _, closeDB, err := openUseCase(logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	report, err := useCase.ImportUsers(ctx, rows)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(usecase.FormatImportReport(report))
+	return nil
+}
+
+func backupCommand(ctx context.Context, logger *zap.Logger, cfg config.Config, action string, fileName string) error {
+	useCase, dbService, closeDB, err := openUseCase(logger, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	switch action {
+	case "export":
+		archive, err := useCase.ExportArchive(ctx)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(fileName, data, 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Exported %d users and %d subscriptions to %s\n", len(archive.Users), len(archive.Subscriptions), fileName)
+	case "restore":
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return err
+		}
+		var archive models.Archive
+		if err := json.Unmarshal(data, &archive); err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		if err := useCase.RestoreArchive(ctx, archive); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %d users and %d subscriptions from %s\n", len(archive.Users), len(archive.Subscriptions), fileName)
+	case "snapshot":
+		if err := dbService.Snapshot(ctx, fileName); err != nil {
+			return err
+		}
+		fmt.Printf("Database snapshot written to %s\n", fileName)
+	default:
+		return fmt.Errorf("unknown backup action %q", action)
+	}
+
+	return nil
+}
@@ -0,0 +1,315 @@
+package controller
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"rutube/infrastructure/logging"
+	"rutube/models"
+	"rutube/usecase"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+const defaultBirthdayWindow = 30
+
+type APIHandlers struct {
+	Logger  *zap.Logger
+	usecase usecase.AdminUseCaseInterface
+}
+
+type userRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	BirthDate string `json:"birth_date"`
+	Username  string `json:"username"`
+	Team      string `json:"team"`
+}
+
+// updateUserRequest uses pointers to tell omitted fields, which are kept,
+// from fields set to an empty string, which are cleared.
+type updateUserRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	BirthDate *string `json:"birth_date"`
+	Username  *string `json:"username"`
+	Team      *string `json:"team"`
+}
+
+type createUserRequest struct {
+	TelegramID int `json:"telegram_id"`
+	userRequest
+}
+
+type subscriptionRequest struct {
+	SubscriberID   int64 `json:"subscriber_id"`
+	SubscribedToID int64 `json:"subscribed_to_id"`
+}
+
+func NewAPIHandlers(logger *zap.Logger, usecase usecase.AdminUseCaseInterface) *APIHandlers {
+	return &APIHandlers{
+		Logger:  logger,
+		usecase: usecase,
+	}
+}
+
+func (a *APIHandlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := a.usecase.ListUsers(r.Context())
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", users, http.StatusOK)
+}
+
+func (a *APIHandlers) GetUser(w http.ResponseWriter, r *http.Request) {
+	telegramID, err := strconv.Atoi(chi.URLParam(r, "telegramID"))
+	if err != nil {
+		writeResponse(a.Logger, w, "invalid telegram id", nil, http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.usecase.GetUser(r.Context(), telegramID)
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", user, http.StatusOK)
+}
+
+func (a *APIHandlers) GetUserByUsername(w http.ResponseWriter, r *http.Request) {
+	user, err := a.usecase.GetUserByUsername(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", user, http.StatusOK)
+}
+
+func (a *APIHandlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(a.Logger, w, "Error in decoding: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.usecase.CreateUser(r.Context(), models.ShortUserInfo{
+		IDTG:      req.TelegramID,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		BirthDate: req.BirthDate,
+		Username:  req.Username,
+		Team:      req.Team,
+	})
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "user created", user, http.StatusCreated)
+}
+
+func (a *APIHandlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	telegramID, err := strconv.Atoi(chi.URLParam(r, "telegramID"))
+	if err != nil {
+		writeResponse(a.Logger, w, "invalid telegram id", nil, http.StatusBadRequest)
+		return
+	}
+
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(a.Logger, w, "Error in decoding: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.usecase.UpdateUser(r.Context(), telegramID, models.UserPatch{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		BirthDate: req.BirthDate,
+		Username:  req.Username,
+		Team:      req.Team,
+	})
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "user updated", user, http.StatusOK)
+}
+
+func (a *APIHandlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	telegramID, err := strconv.Atoi(chi.URLParam(r, "telegramID"))
+	if err != nil {
+		writeResponse(a.Logger, w, "invalid telegram id", nil, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.usecase.DeleteUser(r.Context(), telegramID); err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "user deleted", nil, http.StatusOK)
+}
+
+func (a *APIHandlers) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	var subscriberID int64
+	if value := r.URL.Query().Get("subscriber_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid subscriber_id", nil, http.StatusBadRequest)
+			return
+		}
+		subscriberID = id
+	}
+
+	subscriptions, err := a.usecase.ListSubscriptions(r.Context(), subscriberID)
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", subscriptions, http.StatusOK)
+}
+
+func (a *APIHandlers) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var req subscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeResponse(a.Logger, w, "Error in decoding: "+err.Error(), nil, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.usecase.CreateSubscription(r.Context(), req.SubscriberID, req.SubscribedToID); err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "subscription created", req, http.StatusCreated)
+}
+
+func (a *APIHandlers) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	subscriberID, err := strconv.ParseInt(chi.URLParam(r, "subscriberID"), 10, 64)
+	if err != nil {
+		writeResponse(a.Logger, w, "invalid subscriber id", nil, http.StatusBadRequest)
+		return
+	}
+	subscribedToID, err := strconv.ParseInt(chi.URLParam(r, "subscribedToID"), 10, 64)
+	if err != nil {
+		writeResponse(a.Logger, w, "invalid subscribed to id", nil, http.StatusBadRequest)
+		return
+	}
+
+	if err := a.usecase.DeleteSubscription(r.Context(), subscriberID, subscribedToID); err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "subscription deleted", nil, http.StatusOK)
+}
+
+func (a *APIHandlers) UpcomingBirthdays(w http.ResponseWriter, r *http.Request) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today.AddDate(0, 0, defaultBirthdayWindow)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid 'from' date, expected YYYY-MM-DD", nil, http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid 'to' date, expected YYYY-MM-DD", nil, http.StatusBadRequest)
+			return
+		}
+	}
+
+	birthdays, err := a.usecase.UpcomingBirthdays(r.Context(), from, to)
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", birthdays, http.StatusOK)
+}
+
+func (a *APIHandlers) AuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter models.AuditFilter
+
+	var err error
+	if value := query.Get("telegram_id"); value != "" {
+		filter.TelegramID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid telegram_id", nil, http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("from"); value != "" {
+		filter.From, err = parseAuditTime(value, false)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid 'from', expected RFC 3339 or YYYY-MM-DD", nil, http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		filter.To, err = parseAuditTime(value, true)
+		if err != nil {
+			writeResponse(a.Logger, w, "invalid 'to', expected RFC 3339 or YYYY-MM-DD", nil, http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		filter.Limit, err = strconv.Atoi(value)
+		if err != nil || filter.Limit <= 0 {
+			writeResponse(a.Logger, w, "invalid limit", nil, http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := a.usecase.AuditLog(r.Context(), filter)
+	if err != nil {
+		a.sendError(w, r, err)
+		return
+	}
+	writeResponse(a.Logger, w, "ok", entries, http.StatusOK)
+}
+
+// parseAuditTime accepts a timestamp or a whole day; as the end of a range a
+// day includes all of it.
+func parseAuditTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		return day.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return day, nil
+}
+
+func (a *APIHandlers) OpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
+
+func (a *APIHandlers) sendError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
+		writeResponse(a.Logger, w, err.Error(), nil, http.StatusNotFound)
+	case errors.Is(err, usecase.ErrAlreadyExists):
+		writeResponse(a.Logger, w, err.Error(), nil, http.StatusConflict)
+	case errors.Is(err, usecase.ErrInvalidInput):
+		writeResponse(a.Logger, w, err.Error(), nil, http.StatusBadRequest)
+	default:
+		logging.FromContext(r.Context(), a.Logger).Error("Error in API handler", zap.Error(err))
+		writeResponse(a.Logger, w, "internal error", nil, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"rutube/infrastructure/logging"
+	"rutube/usecase"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+func (h *Handlers) CalendarFeed(w http.ResponseWriter, r *http.Request) {
+	data, err := h.usecase.CalendarFeed(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, usecase.ErrNotFound) {
+			h.sendResponse(w, "calendar not found", http.StatusNotFound)
+			return
+		}
+		logging.FromContext(r.Context(), h.Logger).Error("Error building calendar feed", zap.Error(err))
+		h.sendResponse(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="birthdays.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
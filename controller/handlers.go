@@ -1,8 +1,13 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"rutube/infrastructure/audit"
+	"rutube/infrastructure/logging"
+	"rutube/infrastructure/metrics"
 	"rutube/models"
 	"rutube/usecase"
 	"strings"
@@ -15,14 +20,26 @@ type Updates struct {
 }
 
 type ApiResponse struct {
-	Message string `json:"message"`
-	Success bool   `json:"success"`
+	Message string      `json:"message"`
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 type Handlers struct {
 	Logger  *zap.Logger
 	usecase usecase.UseCaseInterface
-	Update  Updates
+}
+
+// senderID is the Telegram user behind the update, whatever its kind.
+func (u *Updates) senderID() int64 {
+	switch {
+	case u.CallbackQuery != nil:
+		return u.CallbackQuery.From.ID
+	case u.MyChatMember != nil:
+		return u.MyChatMember.From.ID
+	default:
+		return u.Message.From.ID
+	}
 }
 
 func NewHandlers(logger *zap.Logger, usecase usecase.UseCaseInterface) *Handlers {
@@ -32,95 +49,338 @@ func NewHandlers(logger *zap.Logger, usecase usecase.UseCaseInterface) *Handlers
 	}
 }
 
+// CommandHandler decodes every update into its own value: the handler is
+// shared between concurrent webhook requests.
 func (h *Handlers) CommandHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
 
-	err := json.NewDecoder(r.Body).Decode(&h.Update)
+	ctx := r.Context()
+	var update Updates
+	err := json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
-		h.Logger.Error("Error in decoding ", zap.Error(err))
+		logging.FromContext(ctx, h.Logger).Error("Error in decoding ", zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.sendResponse(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		h.sendResponse(w, "Error in decoding: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	ctx = audit.WithActor(ctx, audit.TelegramActor(update.senderID()))
 
-	if h.Update.Message.Text != "" {
-		err := h.messageHandler(w, r)
-		h.Update = Updates{}
+	if update.CallbackQuery != nil {
+		metrics.UpdatesTotal.WithLabelValues("callback_query").Inc()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{})
+		h.callbackQuery(ctx, &update)
+	} else if update.MyChatMember != nil {
+		metrics.UpdatesTotal.WithLabelValues("my_chat_member").Inc()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{})
+		h.chatMemberUpdated(ctx, &update)
+	} else if update.Message.Text != "" {
+		err := h.messageHandler(ctx, w, &update)
 		if err != nil {
-			h.Logger.Error(err.Error())
+			logging.FromContext(ctx, h.Logger).Error(err.Error())
 			h.sendResponse(w, "Wrong Way", http.StatusBadRequest)
 			return
 		}
+	} else if update.Message.Document != nil {
+		metrics.UpdatesTotal.WithLabelValues("document").Inc()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{})
+		h.importDocument(ctx, &update)
 	}
-
-	defer r.Body.Close()
 }
 
-func (h *Handlers) messageHandler(w http.ResponseWriter, r *http.Request) error {
-	messageParts := strings.SplitN(h.Update.Message.Text, " ", 2)
+func (h *Handlers) messageHandler(ctx context.Context, w http.ResponseWriter, update *Updates) error {
+	messageParts := strings.SplitN(update.Message.Text, " ", 2)
 	command := messageParts[0]
 	var param string
 	if len(messageParts) > 1 {
 		param = messageParts[1]
 	}
+	metrics.UpdatesTotal.WithLabelValues(commandLabel(command)).Inc()
 
 	switch command {
 	case "/start":
 		{
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
-			h.startHandler()
+			h.startHandler(ctx, update)
 		}
 	case "/allUser":
 		{
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
-			h.setAllUser()
+			h.setAllUser(ctx, update)
 		}
 	case "/sub":
 		{
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
-			h.setSub(param)
+			h.setSub(ctx, update, param)
+		}
+	case "/calendar":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.sendCalendar(ctx, update, param)
+		}
+	case "/backup":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.backup(ctx, update)
+		}
+	case "/forgetme":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.forgetMe(ctx, update, param)
+		}
+	case "/mydata":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.myData(ctx, update)
+		}
+	case "/biosync":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.bioSync(ctx, update, param)
+		}
+	case "/fund":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.fund(ctx, update, param)
+		}
+	case "/wishlist":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.wishlist(ctx, update, param)
+		}
+	case "/event":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.event(ctx, update, param)
+		}
+	case "/settings":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.settings(ctx, update, param)
+		}
+	case "/vacation":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.vacation(ctx, update, param)
+		}
+	case "/audit":
+		{
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte{})
+			h.audit(ctx, update, param)
 		}
 	default:
 		{
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte{})
-			h.setMessage(h.Update.Message.Text)
+			h.setMessage(ctx, update, update.Message.Text)
 		}
 	}
 	return nil
 }
 
-func (h *Handlers) startHandler() {
-	h.usecase.StartCase(h.Update.Message.From.FirstName, h.Update.Message.From.LastName, int(h.Update.Message.From.ID))
+var commands = map[string]bool{
+	"/start":    true,
+	"/allUser":  true,
+	"/sub":      true,
+	"/calendar": true,
+	"/backup":   true,
+	"/forgetme": true,
+	"/mydata":   true,
+	"/biosync":  true,
+	"/fund":     true,
+	"/wishlist": true,
+	"/event":    true,
+	"/settings": true,
+	"/vacation": true,
+	"/audit":    true,
+}
+
+// commandLabel keeps free text out of metric labels.
+func commandLabel(command string) string {
+	if commands[command] {
+		return command
+	}
+	return "text"
 }
 
-func (h *Handlers) setMessage(date string) {
-	h.usecase.SetBirthday(date, int(h.Update.Message.From.ID))
+func (h *Handlers) startHandler(ctx context.Context, update *Updates) {
+	err := h.usecase.StartCase(ctx, update.Message.From.FirstName, update.Message.From.LastName, update.Message.From.Username, int(update.Message.From.ID))
+	if err != nil {
+		h.handlerError(ctx, "startHandler", err)
+	}
 }
 
-func (h *Handlers) setAllUser() {
-	h.usecase.SetAllUser(int(h.Update.Message.From.ID))
+func (h *Handlers) importDocument(ctx context.Context, update *Updates) {
+	document := update.Message.Document
+	err := h.usecase.ImportDocument(ctx, int(update.Message.From.ID), document.FileID, document.FileName)
+	if err != nil {
+		h.handlerError(ctx, "importDocument", err)
+	}
 }
 
-func (h *Handlers) setSub(sub string) {
-	err := h.usecase.SetSub(int(h.Update.Message.From.ID), sub)
+func (h *Handlers) chatMemberUpdated(ctx context.Context, update *Updates) {
+	member := update.MyChatMember
+	if member.Chat.Type != "private" {
+		return
+	}
+	err := h.usecase.ChatMemberUpdated(ctx, int(member.From.ID), member.NewChatMember.Status)
 	if err != nil {
-		h.Logger.Error("Error in setSub handler", zap.Error(err))
+		h.handlerError(ctx, "chatMemberUpdated", err)
 	}
 }
 
+func (h *Handlers) callbackQuery(ctx context.Context, update *Updates) {
+	query := update.CallbackQuery
+	// The message is omitted when it is too old for Telegram to return it.
+	var messageID int
+	if query.Message != nil {
+		messageID = query.Message.MessageID
+	}
+	err := h.usecase.CallbackQuery(ctx, query.ID, int(query.From.ID), messageID, query.Data)
+	if err != nil {
+		h.handlerError(ctx, "callbackQuery", err)
+	}
+}
+
+func (h *Handlers) setMessage(ctx context.Context, update *Updates, date string) {
+	err := h.usecase.SetBirthday(ctx, date, int(update.Message.From.ID))
+	if err != nil {
+		h.handlerError(ctx, "setMessage", err)
+	}
+}
+
+func (h *Handlers) setAllUser(ctx context.Context, update *Updates) {
+	err := h.usecase.SetAllUser(ctx, int(update.Message.From.ID))
+	if err != nil {
+		h.handlerError(ctx, "setAllUser", err)
+	}
+}
+
+func (h *Handlers) setSub(ctx context.Context, update *Updates, sub string) {
+	err := h.usecase.SetSub(ctx, int(update.Message.From.ID), sub)
+	if err != nil {
+		h.handlerError(ctx, "setSub", err)
+	}
+}
+
+func (h *Handlers) sendCalendar(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.SendCalendar(ctx, int(update.Message.From.ID), strings.TrimSpace(param))
+	if err != nil {
+		h.handlerError(ctx, "sendCalendar", err)
+	}
+}
+
+func (h *Handlers) backup(ctx context.Context, update *Updates) {
+	err := h.usecase.BackupCase(ctx, int(update.Message.From.ID))
+	if err != nil {
+		h.handlerError(ctx, "backup", err)
+	}
+}
+
+func (h *Handlers) forgetMe(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.ForgetMe(ctx, int(update.Message.From.ID), strings.TrimSpace(param))
+	if err != nil {
+		h.handlerError(ctx, "forgetMe", err)
+	}
+}
+
+func (h *Handlers) myData(ctx context.Context, update *Updates) {
+	err := h.usecase.MyData(ctx, int(update.Message.From.ID))
+	if err != nil {
+		h.handlerError(ctx, "myData", err)
+	}
+}
+
+func (h *Handlers) bioSync(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.BioSync(ctx, int(update.Message.From.ID), strings.TrimSpace(param))
+	if err != nil {
+		h.handlerError(ctx, "bioSync", err)
+	}
+}
+
+func (h *Handlers) fund(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Fund(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "fund", err)
+	}
+}
+
+func (h *Handlers) wishlist(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Wishlist(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "wishlist", err)
+	}
+}
+
+func (h *Handlers) event(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Event(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "event", err)
+	}
+}
+
+func (h *Handlers) settings(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Settings(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "settings", err)
+	}
+}
+
+func (h *Handlers) vacation(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Vacation(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "vacation", err)
+	}
+}
+
+func (h *Handlers) audit(ctx context.Context, update *Updates, param string) {
+	err := h.usecase.Audit(ctx, int(update.Message.From.ID), param)
+	if err != nil {
+		h.handlerError(ctx, "audit", err)
+	}
+}
+
+func (h *Handlers) handlerError(ctx context.Context, handler string, err error) {
+	metrics.HandlerErrors.WithLabelValues(handler).Inc()
+	logging.FromContext(ctx, h.Logger).Error("Error in "+handler+" handler", zap.Error(err))
+}
+
 func (h *Handlers) sendResponse(w http.ResponseWriter, message string, statusCode int) {
+	writeResponse(h.Logger, w, message, nil, statusCode)
+}
+
+func writeResponse(logger *zap.Logger, w http.ResponseWriter, message string, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
 	response := ApiResponse{
 		Message: message,
 		Success: statusCode >= 200 && statusCode < 300,
+		Data:    data,
 	}
 
 	err := json.NewEncoder(w).Encode(response)
 	if err != nil {
-		h.Logger.Error("Не получилось создать ответ", zap.Error(err))
+		logger.Error("Не получилось создать ответ", zap.Error(err))
 	}
 }
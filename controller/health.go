@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"net/http"
+	"rutube/infrastructure/health"
+
+	"go.uber.org/zap"
+)
+
+type HealthHandlers struct {
+	Logger  *zap.Logger
+	checker *health.Checker
+}
+
+func NewHealthHandlers(logger *zap.Logger, checker *health.Checker) *HealthHandlers {
+	return &HealthHandlers{
+		Logger:  logger,
+		checker: checker,
+	}
+}
+
+// Healthz only tells that the process is alive and serving HTTP.
+func (hh *HealthHandlers) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeResponse(hh.Logger, w, "ok", nil, http.StatusOK)
+}
+
+func (hh *HealthHandlers) Readyz(w http.ResponseWriter, r *http.Request) {
+	result := hh.checker.Run(r.Context())
+	if !result.Ready {
+		hh.Logger.Warn("Readiness check failed", zap.Any("checks", result.Checks))
+		writeResponse(hh.Logger, w, "not ready", result, http.StatusServiceUnavailable)
+		return
+	}
+
+	writeResponse(hh.Logger, w, "ready", result, http.StatusOK)
+}
@@ -4,4 +4,25 @@ import "net/http"
 
 type HandlersInterface interface {
 	CommandHandler(w http.ResponseWriter, r *http.Request)
+	CalendarFeed(w http.ResponseWriter, r *http.Request)
+}
+
+type HealthHandlersInterface interface {
+	Healthz(w http.ResponseWriter, r *http.Request)
+	Readyz(w http.ResponseWriter, r *http.Request)
+}
+
+type APIHandlersInterface interface {
+	ListUsers(w http.ResponseWriter, r *http.Request)
+	GetUser(w http.ResponseWriter, r *http.Request)
+	GetUserByUsername(w http.ResponseWriter, r *http.Request)
+	CreateUser(w http.ResponseWriter, r *http.Request)
+	UpdateUser(w http.ResponseWriter, r *http.Request)
+	DeleteUser(w http.ResponseWriter, r *http.Request)
+	ListSubscriptions(w http.ResponseWriter, r *http.Request)
+	CreateSubscription(w http.ResponseWriter, r *http.Request)
+	DeleteSubscription(w http.ResponseWriter, r *http.Request)
+	UpcomingBirthdays(w http.ResponseWriter, r *http.Request)
+	AuditLog(w http.ResponseWriter, r *http.Request)
+	OpenAPISpec(w http.ResponseWriter, r *http.Request)
 }
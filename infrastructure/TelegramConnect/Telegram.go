@@ -1,27 +1,47 @@
 package telegramconnect
 
 import (
+	"context"
 	"errors"
-	"os"
+	"fmt"
+	"io"
+	"net/http"
+	"rutube/infrastructure/metrics"
+	"rutube/models"
+	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"go.uber.org/zap"
 )
 
+const (
+	requestTimeout  = 15 * time.Second
+	getMeCacheTTL   = time.Minute
+	downloadTimeout = 60 * time.Second
+	maxDownloadSize = 20 << 20
+)
+
 type TelegramClient struct {
 	Logger *zap.Logger
 	Bot    *tgbotapi.BotAPI
+
+	pingMu      sync.Mutex
+	pingChecked time.Time
+	pingErr     error
 }
 
-func NewTelegramClient(logger *zap.Logger) (*TelegramClient, error) {
+func NewTelegramClient(logger *zap.Logger, token string) (*TelegramClient, error) {
 
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if token == "" {
-		logger.Error("TELEGRAM_BOT_TOKEN not set in .env file")
-		return nil, errors.New("TELEGRAM_BOT_TOKEN not set in .env file")
+		logger.Error("Telegram bot token is not configured")
+		return nil, errors.New("telegram bot token is not configured, set TELEGRAM_BOT_TOKEN")
 	}
 
-	bot, err := tgbotapi.NewBotAPI(token)
+	// The library does not accept a context, so the HTTP client timeout is the
+	// hard upper bound for a single call even if the caller stops waiting.
+	client := &http.Client{Timeout: downloadTimeout}
+	bot, err := tgbotapi.NewBotAPIWithClient(token, tgbotapi.APIEndpoint, client)
 	if err != nil {
 		logger.Error("Failed to create Telegram bot", zap.Error(err))
 		return nil, err
@@ -33,13 +53,95 @@ func NewTelegramClient(logger *zap.Logger) (*TelegramClient, error) {
 	}, nil
 }
 
-func (tc *TelegramClient) GetUserInfo(userID int64) (*tgbotapi.Chat, error) {
+// call runs a blocking Bot API request and gives up as soon as ctx is done or
+// the per-request deadline expires. method is the Bot API method name used
+// as the metrics label.
+func call[T any](ctx context.Context, method string, fn func() (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	metrics.TelegramRequests.WithLabelValues(method).Inc()
+	value, err := wait(ctx, fn)
+	if err != nil {
+		metrics.TelegramFailures.WithLabelValues(method).Inc()
+	}
+	return value, err
+}
+
+func wait[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn()
+		done <- result{value, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Ping calls getMe at most once per getMeCacheTTL and returns the cached
+// result in between, so frequent readiness probes do not hit the Bot API.
+func (tc *TelegramClient) Ping(ctx context.Context) error {
+	tc.pingMu.Lock()
+	defer tc.pingMu.Unlock()
+
+	if time.Since(tc.pingChecked) < getMeCacheTTL {
+		return tc.pingErr
+	}
+
+	_, err := call(ctx, "getMe", func() (tgbotapi.User, error) {
+		return tc.Bot.GetMe()
+	})
+	if ctx.Err() != nil {
+		return err
+	}
+
+	tc.pingChecked = time.Now()
+	tc.pingErr = err
+	return err
+}
+
+// SetWebhook registers url with Telegram. certificate is the PEM encoded
+// public certificate of a self-signed setup; pass nil for a trusted one.
+func (tc *TelegramClient) SetWebhook(ctx context.Context, url string, certificate []byte) error {
+	webhook, err := tgbotapi.NewWebhook(url)
+	if certificate != nil {
+		webhook, err = tgbotapi.NewWebhookWithCert(url, tgbotapi.FileBytes{Name: "certificate.pem", Bytes: certificate})
+	}
+	if err != nil {
+		return fmt.Errorf("invalid webhook url: %w", err)
+	}
+
+	_, err = call(ctx, "setWebhook", func() (*tgbotapi.APIResponse, error) {
+		return tc.Bot.Request(webhook)
+	})
+	if err != nil {
+		tc.Logger.Error("Failed to register webhook", zap.Error(err))
+		return err
+	}
+
+	tc.Logger.Info("Webhook registered", zap.String("url", url), zap.Bool("certificate", certificate != nil))
+	return nil
+}
+
+func (tc *TelegramClient) GetUserInfo(ctx context.Context, userID int64) (*tgbotapi.Chat, error) {
 
 	var config tgbotapi.ChatInfoConfig = tgbotapi.ChatInfoConfig{
 		ChatConfig: tgbotapi.ChatConfig{ChatID: userID},
 	}
 
-	chat, err := tc.Bot.GetChat(config)
+	chat, err := call(ctx, "getChat", func() (tgbotapi.Chat, error) {
+		return tc.Bot.GetChat(config)
+	})
 	if err != nil {
 		tc.Logger.Error("Failed to get chat info from Telegram", zap.Error(err))
 		return nil, err
@@ -47,12 +149,136 @@ func (tc *TelegramClient) GetUserInfo(userID int64) (*tgbotapi.Chat, error) {
 	return &chat, nil
 }
 
-func (tc *TelegramClient) Response(userID int64, message string) error {
+func (tc *TelegramClient) Response(ctx context.Context, userID int64, message string) error {
+
+	msg := tgbotapi.NewMessage(userID, message)
+	_, err := call(ctx, "sendMessage", func() (tgbotapi.Message, error) {
+		return tc.Bot.Send(msg)
+	})
+	if err != nil {
+		tc.Logger.Error("Error sending message to user", zap.Int64("chat_id", userID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (tc *TelegramClient) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	url, err := call(ctx, "getFile", func() (string, error) {
+		return tc.Bot.GetFileDirectURL(fileID)
+	})
+	if err != nil {
+		tc.Logger.Error("Failed to get file URL from Telegram", zap.Error(err))
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tc.Logger.Error("Failed to download file from Telegram", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status downloading file: %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
+
+func (tc *TelegramClient) SendDocument(ctx context.Context, userID int64, fileName string, data []byte, caption string) error {
+	doc := tgbotapi.NewDocument(userID, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	doc.Caption = caption
+
+	_, err := call(ctx, "sendDocument", func() (tgbotapi.Message, error) {
+		return tc.Bot.Send(doc)
+	})
+	if err != nil {
+		tc.Logger.Error("Error sending document to user", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// SendButtons sends a message with one row of inline buttons.
+func (tc *TelegramClient) SendButtons(ctx context.Context, userID int64, message string, buttons []models.Button) error {
+	return tc.SendMenu(ctx, userID, message, [][]models.Button{buttons})
+}
 
+// SendMenu sends a message with inline buttons laid out in rows.
+func (tc *TelegramClient) SendMenu(ctx context.Context, userID int64, message string, rows [][]models.Button) error {
 	msg := tgbotapi.NewMessage(userID, message)
-	_, err := tc.Bot.Send(msg)
+	msg.ReplyMarkup = inlineKeyboard(rows)
+	_, err := call(ctx, "sendMessage", func() (tgbotapi.Message, error) {
+		return tc.Bot.Send(msg)
+	})
+	if err != nil {
+		tc.Logger.Error("Error sending message to user", zap.Int64("chat_id", userID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// EditMessage replaces the text of a sent message and drops its buttons.
+func (tc *TelegramClient) EditMessage(ctx context.Context, chatID int64, messageID int, message string) error {
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, message)
+	_, err := call(ctx, "editMessageText", func() (tgbotapi.Message, error) {
+		return tc.Bot.Send(edit)
+	})
+	if err != nil {
+		tc.Logger.Error("Error editing message", zap.Int64("chat_id", chatID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// EditMenu replaces the text and the buttons of a sent message.
+func (tc *TelegramClient) EditMenu(ctx context.Context, chatID int64, messageID int, message string, rows [][]models.Button) error {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, message, inlineKeyboard(rows))
+	_, err := call(ctx, "editMessageText", func() (tgbotapi.Message, error) {
+		return tc.Bot.Send(edit)
+	})
+	if err != nil {
+		tc.Logger.Error("Error editing message", zap.Int64("chat_id", chatID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func inlineKeyboard(rows [][]models.Button) tgbotapi.InlineKeyboardMarkup {
+	keyboard := make([][]tgbotapi.InlineKeyboardButton, 0, len(rows))
+	for _, buttons := range rows {
+		row := make([]tgbotapi.InlineKeyboardButton, 0, len(buttons))
+		for _, button := range buttons {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(button.Text, button.Data))
+		}
+		keyboard = append(keyboard, row)
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
+
+// AnswerCallback stops the loading indicator on the pressed button; a
+// non-empty text is shown to the user as a notification.
+func (tc *TelegramClient) AnswerCallback(ctx context.Context, callbackID string, text string) error {
+	answer := tgbotapi.NewCallback(callbackID, text)
+	_, err := call(ctx, "answerCallbackQuery", func() (*tgbotapi.APIResponse, error) {
+		return tc.Bot.Request(answer)
+	})
 	if err != nil {
-		tc.Logger.Error("Error sending message to user", zap.Error(err))
+		tc.Logger.Error("Error answering callback query", zap.Error(err))
+		return err
 	}
 
 	return nil
@@ -0,0 +1,36 @@
+package telegramconnect
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// RetryAfter reports how long Telegram asked to wait before the next request
+// when the flood limit was hit.
+func RetryAfter(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return 0, false
+	}
+	return time.Duration(apiErr.RetryAfter) * time.Second, true
+}
+
+// IsBlocked reports that the user blocked the bot or deleted their account,
+// so no message can reach them until they talk to the bot again.
+func IsBlocked(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+// IsPermanent reports errors that repeating the same request cannot fix, such
+// as a bot blocked by the user, a deleted chat or a malformed message.
+func IsPermanent(err error) bool {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusForbidden
+}
@@ -0,0 +1,35 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+)
+
+// Actors that are not a Telegram user.
+const (
+	ActorSystem = "system"
+	ActorAPI    = "api"
+	ActorCLI    = "cli"
+)
+
+type actorKey struct{}
+
+// TelegramActor names the Telegram user who sent the update being handled.
+func TelegramActor(telegramID int64) string {
+	return "telegram:" + strconv.FormatInt(telegramID, 10)
+}
+
+// WithActor stores who is making the changes done with ctx; they end up in
+// the audit log.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored by WithActor, or ActorSystem for
+// background jobs.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return ActorSystem
+}
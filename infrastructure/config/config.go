@@ -0,0 +1,518 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"rutube/infrastructure/database"
+	"rutube/infrastructure/outbox"
+	"rutube/infrastructure/server"
+	"rutube/infrastructure/workcalendar"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ModeProduction  = "production"
+	ModeDevelopment = "development"
+
+	defaultConfigFile = "config.yaml"
+	redacted          = "***"
+)
+
+type Config struct {
+	Mode      string          `yaml:"mode"`
+	LogLevel  string          `yaml:"log_level"`
+	PublicURL string          `yaml:"public_url"`
+	Database  DatabaseConfig  `yaml:"database"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Telegram  TelegramConfig  `yaml:"telegram"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+	Outbox    OutboxConfig    `yaml:"outbox"`
+	Calendar  CalendarConfig  `yaml:"calendar"`
+}
+
+type DatabaseConfig struct {
+	Driver       string        `yaml:"driver"`
+	DSN          string        `yaml:"dsn"`
+	MaxOpenConns int           `yaml:"max_open_conns"`
+	BusyTimeout  time.Duration `yaml:"busy_timeout"`
+}
+
+type HTTPConfig struct {
+	Addr            string        `yaml:"addr"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	DrainDelay      time.Duration `yaml:"drain_delay"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+
+	TLSCertFile   string `yaml:"tls_cert_file"`
+	TLSKeyFile    string `yaml:"tls_key_file"`
+	TLSSelfSigned bool   `yaml:"tls_self_signed"`
+}
+
+type TelegramConfig struct {
+	Token      string `yaml:"token"`
+	WebhookURL string `yaml:"webhook_url"`
+	// UploadCertificate sends the server certificate along with the webhook,
+	// which Telegram requires for self-signed certificates.
+	UploadCertificate bool `yaml:"upload_certificate"`
+}
+
+type AdminConfig struct {
+	APIToken    string  `yaml:"api_token"`
+	TelegramIDs []int64 `yaml:"telegram_ids"`
+}
+
+type SchedulerConfig struct {
+	BackupInterval time.Duration `yaml:"backup_interval"`
+	BackupDir      string        `yaml:"backup_dir"`
+	BackupKeep     int           `yaml:"backup_keep"`
+
+	ReminderInterval   time.Duration `yaml:"reminder_interval"`
+	ReminderHour       int           `yaml:"reminder_hour"`
+	ReminderDaysBefore int           `yaml:"reminder_days_before"`
+
+	ProfileSyncInterval time.Duration `yaml:"profile_sync_interval"`
+
+	// TimeZone is the IANA zone of users who have not chosen their own; empty
+	// means the server's zone.
+	TimeZone string `yaml:"time_zone"`
+}
+
+type OutboxConfig struct {
+	Rate         int           `yaml:"rate"`
+	ChatInterval time.Duration `yaml:"chat_interval"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+	Retention    time.Duration `yaml:"retention"`
+}
+
+// CalendarConfig decides what happens to an on-the-day announcement that falls
+// on a day off: it moves to the previous or next working day, or stays put.
+// TeamPolicies override DefaultPolicy for users of that team.
+type CalendarConfig struct {
+	File          string            `yaml:"file"`
+	DefaultPolicy string            `yaml:"default_policy"`
+	TeamPolicies  map[string]string `yaml:"team_policies"`
+}
+
+func Default() Config {
+	return Config{
+		Mode:     ModeProduction,
+		LogLevel: "info",
+		Database: DatabaseConfig{
+			Driver:       "sqlite3",
+			DSN:          "Date.db",
+			MaxOpenConns: 4,
+			BusyTimeout:  5 * time.Second,
+		},
+		HTTP: HTTPConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 5 * time.Second,
+
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+		},
+		Scheduler: SchedulerConfig{
+			BackupInterval: 24 * time.Hour,
+			BackupDir:      "backups",
+			BackupKeep:     7,
+
+			ReminderInterval:   15 * time.Minute,
+			ReminderHour:       9,
+			ReminderDaysBefore: 3,
+
+			ProfileSyncInterval: 24 * time.Hour,
+		},
+		Outbox: OutboxConfig{
+			Rate:         25,
+			ChatInterval: time.Second,
+			PollInterval: 2 * time.Second,
+			BatchSize:    100,
+			MaxAttempts:  5,
+			Retention:    30 * 24 * time.Hour,
+		},
+		Calendar: CalendarConfig{
+			DefaultPolicy: workcalendar.PolicyNone,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence:
+// defaults, the YAML file (CONFIG_FILE or ./config.yaml if present), the .env
+// file and the process environment. Variables already set in the environment
+// are never overridden by .env.
+func Load() (Config, error) {
+	cfg := Default()
+
+	path := os.Getenv("CONFIG_FILE")
+	required := path != ""
+	if path == "" {
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !required:
+	default:
+		return cfg, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	err = godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("failed to load .env file: %w", err)
+	}
+
+	return cfg, errors.Join(cfg.applyEnv(), cfg.Validate())
+}
+
+func (c *Config) applyEnv() error {
+	setString := func(name string, target *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+
+	setString("APP_MODE", &c.Mode)
+	setString("LOG_LEVEL", &c.LogLevel)
+	setString("PUBLIC_URL", &c.PublicURL)
+	setString("DB_DRIVER", &c.Database.Driver)
+	setString("DB_DSN", &c.Database.DSN)
+	setString("HTTP_ADDR", &c.HTTP.Addr)
+	setString("TELEGRAM_BOT_TOKEN", &c.Telegram.Token)
+	setString("TELEGRAM_WEBHOOK_URL", &c.Telegram.WebhookURL)
+	setString("ADMIN_API_TOKEN", &c.Admin.APIToken)
+	setString("BACKUP_DIR", &c.Scheduler.BackupDir)
+	setString("TIME_ZONE", &c.Scheduler.TimeZone)
+	setString("TLS_CERT_FILE", &c.HTTP.TLSCertFile)
+	setString("TLS_KEY_FILE", &c.HTTP.TLSKeyFile)
+	setString("CALENDAR_FILE", &c.Calendar.File)
+	setString("CALENDAR_DEFAULT_POLICY", &c.Calendar.DefaultPolicy)
+
+	var errs []error
+	setDuration := func(name string, target *time.Duration) {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*target = d
+		}
+	}
+	setInt := func(name string, target *int) {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*target = n
+		}
+	}
+
+	setBool := func(name string, target *bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*target = b
+		}
+	}
+
+	setDuration("DB_BUSY_TIMEOUT", &c.Database.BusyTimeout)
+	setInt("DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	setDuration("SHUTDOWN_TIMEOUT", &c.HTTP.ShutdownTimeout)
+	setDuration("HTTP_DRAIN_DELAY", &c.HTTP.DrainDelay)
+	setDuration("HTTP_READ_TIMEOUT", &c.HTTP.ReadTimeout)
+	setDuration("HTTP_WRITE_TIMEOUT", &c.HTTP.WriteTimeout)
+	setDuration("HTTP_IDLE_TIMEOUT", &c.HTTP.IdleTimeout)
+	setBool("TLS_SELF_SIGNED", &c.HTTP.TLSSelfSigned)
+	setBool("TELEGRAM_UPLOAD_CERTIFICATE", &c.Telegram.UploadCertificate)
+	setDuration("BACKUP_INTERVAL", &c.Scheduler.BackupInterval)
+	setInt("BACKUP_KEEP", &c.Scheduler.BackupKeep)
+	setDuration("REMINDER_INTERVAL", &c.Scheduler.ReminderInterval)
+	setInt("REMINDER_HOUR", &c.Scheduler.ReminderHour)
+	setInt("REMINDER_DAYS_BEFORE", &c.Scheduler.ReminderDaysBefore)
+	setDuration("PROFILE_SYNC_INTERVAL", &c.Scheduler.ProfileSyncInterval)
+	setInt("OUTBOX_RATE", &c.Outbox.Rate)
+	setDuration("OUTBOX_CHAT_INTERVAL", &c.Outbox.ChatInterval)
+	setInt("OUTBOX_MAX_ATTEMPTS", &c.Outbox.MaxAttempts)
+
+	if value, ok := os.LookupEnv("ADMIN_TELEGRAM_IDS"); ok {
+		ids, err := parseIDs(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ADMIN_TELEGRAM_IDS: %w", err))
+		} else {
+			c.Admin.TelegramIDs = ids
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Mode != ModeProduction && c.Mode != ModeDevelopment {
+		errs = append(errs, fmt.Errorf("mode must be %q or %q, got %q", ModeProduction, ModeDevelopment, c.Mode))
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	if c.Database.Driver != "sqlite3" {
+		errs = append(errs, fmt.Errorf("database.driver %q is not supported, only sqlite3", c.Database.Driver))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database.max_open_conns must be at least 1"))
+	}
+	if c.Database.BusyTimeout < 0 {
+		errs = append(errs, errors.New("database.busy_timeout must not be negative"))
+	}
+	if c.HTTP.Addr == "" {
+		errs = append(errs, errors.New("http.addr is required"))
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("http.shutdown_timeout must be positive"))
+	}
+	if c.HTTP.DrainDelay < 0 {
+		errs = append(errs, errors.New("http.drain_delay must not be negative"))
+	}
+	if c.HTTP.ReadTimeout < 0 || c.HTTP.ReadHeaderTimeout < 0 || c.HTTP.WriteTimeout < 0 || c.HTTP.IdleTimeout < 0 {
+		errs = append(errs, errors.New("http timeouts must not be negative"))
+	}
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		errs = append(errs, errors.New("http.tls_cert_file and http.tls_key_file must be set together"))
+	}
+	if c.HTTP.TLSSelfSigned && c.HTTP.TLSCertFile != "" {
+		errs = append(errs, errors.New("http.tls_self_signed cannot be combined with http.tls_cert_file"))
+	}
+	if c.Telegram.UploadCertificate && !c.HTTP.TLSSelfSigned && c.HTTP.TLSCertFile == "" {
+		errs = append(errs, errors.New("telegram.upload_certificate requires http.tls_self_signed or http.tls_cert_file"))
+	}
+	if c.Telegram.WebhookURL != "" {
+		if err := validateURL(c.Telegram.WebhookURL, "https"); err != nil {
+			errs = append(errs, fmt.Errorf("telegram.webhook_url: %w", err))
+		}
+	}
+	if c.PublicURL != "" {
+		if err := validateURL(c.PublicURL, ""); err != nil {
+			errs = append(errs, fmt.Errorf("public_url: %w", err))
+		}
+	}
+	if c.Scheduler.BackupInterval <= 0 {
+		errs = append(errs, errors.New("scheduler.backup_interval must be positive"))
+	}
+	if c.Scheduler.BackupKeep < 0 {
+		errs = append(errs, errors.New("scheduler.backup_keep must not be negative"))
+	}
+	if c.Scheduler.ReminderInterval <= 0 {
+		errs = append(errs, errors.New("scheduler.reminder_interval must be positive"))
+	}
+	if c.Scheduler.ReminderHour < 0 || c.Scheduler.ReminderHour > 23 {
+		errs = append(errs, errors.New("scheduler.reminder_hour must be between 0 and 23"))
+	}
+	if c.Scheduler.ReminderDaysBefore < 0 {
+		errs = append(errs, errors.New("scheduler.reminder_days_before must not be negative"))
+	}
+	if c.Scheduler.ProfileSyncInterval <= 0 {
+		errs = append(errs, errors.New("scheduler.profile_sync_interval must be positive"))
+	}
+	if _, err := time.LoadLocation(c.Scheduler.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("scheduler.time_zone: %w", err))
+	}
+	if c.Outbox.Rate < 1 || c.Outbox.Rate > 30 {
+		errs = append(errs, errors.New("outbox.rate must be between 1 and 30 messages per second"))
+	}
+	if c.Outbox.ChatInterval < 0 {
+		errs = append(errs, errors.New("outbox.chat_interval must not be negative"))
+	}
+	if c.Outbox.PollInterval <= 0 {
+		errs = append(errs, errors.New("outbox.poll_interval must be positive"))
+	}
+	if c.Outbox.BatchSize < 1 {
+		errs = append(errs, errors.New("outbox.batch_size must be at least 1"))
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		errs = append(errs, errors.New("outbox.max_attempts must be at least 1"))
+	}
+	if c.Outbox.Retention <= 0 {
+		errs = append(errs, errors.New("outbox.retention must be positive"))
+	}
+	if !workcalendar.ValidPolicy(c.Calendar.DefaultPolicy) {
+		errs = append(errs, fmt.Errorf("calendar.default_policy must be %q, %q or %q, got %q",
+			workcalendar.PolicyNone, workcalendar.PolicyPrevious, workcalendar.PolicyNext, c.Calendar.DefaultPolicy))
+	}
+	for team, policy := range c.Calendar.TeamPolicies {
+		if !workcalendar.ValidPolicy(policy) {
+			errs = append(errs, fmt.Errorf("calendar.team_policies.%s: unknown policy %q", team, policy))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c DatabaseConfig) Options() database.Options {
+	return database.Options{
+		MaxOpenConns: c.MaxOpenConns,
+		BusyTimeout:  c.BusyTimeout,
+	}
+}
+
+// Redacted returns a copy that is safe to log.
+func (c Config) Redacted() Config {
+	if c.Telegram.Token != "" {
+		c.Telegram.Token = redacted
+	}
+	if c.Admin.APIToken != "" {
+		c.Admin.APIToken = redacted
+	}
+	return c
+}
+
+func (c Config) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("mode", c.Mode)
+	enc.AddString("log_level", c.LogLevel)
+	enc.AddString("public_url", c.PublicURL)
+	enc.AddString("database.driver", c.Database.Driver)
+	enc.AddString("database.dsn", c.Database.DSN)
+	enc.AddInt("database.max_open_conns", c.Database.MaxOpenConns)
+	enc.AddDuration("database.busy_timeout", c.Database.BusyTimeout)
+	enc.AddString("http.addr", c.HTTP.Addr)
+	enc.AddDuration("http.shutdown_timeout", c.HTTP.ShutdownTimeout)
+	enc.AddDuration("http.drain_delay", c.HTTP.DrainDelay)
+	enc.AddDuration("http.read_timeout", c.HTTP.ReadTimeout)
+	enc.AddDuration("http.read_header_timeout", c.HTTP.ReadHeaderTimeout)
+	enc.AddDuration("http.write_timeout", c.HTTP.WriteTimeout)
+	enc.AddDuration("http.idle_timeout", c.HTTP.IdleTimeout)
+	enc.AddString("http.tls_cert_file", c.HTTP.TLSCertFile)
+	enc.AddString("http.tls_key_file", c.HTTP.TLSKeyFile)
+	enc.AddBool("http.tls_self_signed", c.HTTP.TLSSelfSigned)
+	enc.AddString("telegram.token", c.Telegram.Token)
+	enc.AddString("telegram.webhook_url", c.Telegram.WebhookURL)
+	enc.AddBool("telegram.upload_certificate", c.Telegram.UploadCertificate)
+	enc.AddString("admin.api_token", c.Admin.APIToken)
+	enc.AddInt("admin.telegram_ids", len(c.Admin.TelegramIDs))
+	enc.AddDuration("scheduler.backup_interval", c.Scheduler.BackupInterval)
+	enc.AddString("scheduler.backup_dir", c.Scheduler.BackupDir)
+	enc.AddInt("scheduler.backup_keep", c.Scheduler.BackupKeep)
+	enc.AddDuration("scheduler.reminder_interval", c.Scheduler.ReminderInterval)
+	enc.AddInt("scheduler.reminder_hour", c.Scheduler.ReminderHour)
+	enc.AddInt("scheduler.reminder_days_before", c.Scheduler.ReminderDaysBefore)
+	enc.AddDuration("scheduler.profile_sync_interval", c.Scheduler.ProfileSyncInterval)
+	enc.AddString("scheduler.time_zone", c.Scheduler.TimeZone)
+	enc.AddInt("outbox.rate", c.Outbox.Rate)
+	enc.AddDuration("outbox.chat_interval", c.Outbox.ChatInterval)
+	enc.AddDuration("outbox.poll_interval", c.Outbox.PollInterval)
+	enc.AddInt("outbox.batch_size", c.Outbox.BatchSize)
+	enc.AddInt("outbox.max_attempts", c.Outbox.MaxAttempts)
+	enc.AddDuration("outbox.retention", c.Outbox.Retention)
+	enc.AddString("calendar.file", c.Calendar.File)
+	enc.AddString("calendar.default_policy", c.Calendar.DefaultPolicy)
+	enc.AddInt("calendar.team_policies", len(c.Calendar.TeamPolicies))
+	return nil
+}
+
+// ServerOptions also needs the webhook URL: its host is the name the
+// self-signed certificate is issued for.
+func (c Config) ServerOptions() server.Options {
+	return server.Options{
+		ReadTimeout:       c.HTTP.ReadTimeout,
+		ReadHeaderTimeout: c.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      c.HTTP.WriteTimeout,
+		IdleTimeout:       c.HTTP.IdleTimeout,
+		CertFile:          c.HTTP.TLSCertFile,
+		KeyFile:           c.HTTP.TLSKeyFile,
+		SelfSigned:        c.HTTP.TLSSelfSigned,
+		Hosts:             c.certificateHosts(),
+		DrainDelay:        c.HTTP.DrainDelay,
+	}
+}
+
+func (c Config) certificateHosts() []string {
+	hosts := []string{"localhost"}
+	if u, err := url.Parse(c.Telegram.WebhookURL); err == nil && u.Hostname() != "" {
+		hosts = append([]string{u.Hostname()}, hosts...)
+	}
+	return hosts
+}
+
+// Location is the default time zone of users; Validate has checked the name.
+func (c SchedulerConfig) Location() *time.Location {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil || c.TimeZone == "" {
+		return time.Local
+	}
+	return loc
+}
+
+func (c OutboxConfig) Options() outbox.Options {
+	return outbox.Options{
+		Rate:         c.Rate,
+		ChatInterval: c.ChatInterval,
+		PollInterval: c.PollInterval,
+		BatchSize:    c.BatchSize,
+		MaxAttempts:  c.MaxAttempts,
+	}
+}
+
+func (c Config) ZapLevel() zapcore.Level {
+	level, err := zapcore.ParseLevel(c.LogLevel)
+	if err != nil {
+		return zapcore.InfoLevel
+	}
+	return level
+}
+
+func validateURL(value string, scheme string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", value)
+	}
+	if scheme != "" && u.Scheme != scheme {
+		return fmt.Errorf("%q must use %s", value, scheme)
+	}
+	return nil
+}
+
+func parseIDs(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"rutube/infrastructure/audit"
+	"rutube/models"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var auditColumns = []string{"id", "created_at", "actor", "action", "telegram_id", "related_id", "old_value", "new_value", "source"}
+
+type querier interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// writeAudit appends an entry on behalf of the actor in ctx. Callers pass the
+// transaction of the change, so the change and its entry commit together.
+func writeAudit(ctx context.Context, ex execer, entry models.AuditEntry) error {
+	query, args, err := squirrel.Insert("audit_log").
+		Columns("actor", "action", "telegram_id", "related_id", "old_value", "new_value", "source").
+		Values(audit.ActorFrom(ctx), entry.Action, entry.TelegramID, entry.RelatedID, entry.OldValue, entry.NewValue, entry.Source).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = ex.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// auditEventChange records a changed event date. Birthdays get an action of
+// their own, the other types carry the type in the values.
+func auditEventChange(ctx context.Context, ex execer, telegramID int64, eventType string, oldDate string, newDate string, source string) error {
+	if oldDate == newDate {
+		return nil
+	}
+
+	entry := models.AuditEntry{
+		Action:     models.AuditBirthdayChanged,
+		TelegramID: telegramID,
+		OldValue:   oldDate,
+		NewValue:   newDate,
+		Source:     source,
+	}
+	if eventType != models.EventBirthday {
+		entry.Action = models.AuditEventChanged
+		if oldDate != "" {
+			entry.OldValue = eventType + " " + oldDate
+		}
+		if newDate != "" {
+			entry.NewValue = eventType + " " + newDate
+		}
+	}
+	return writeAudit(ctx, ex, entry)
+}
+
+// userSummary is how a user's profile appears in audit values.
+func userSummary(user models.ShortUserInfo) string {
+	parts := []string{strings.TrimSpace(user.FirstName + " " + user.LastName)}
+	if user.Username != "" {
+		parts = append(parts, "@"+user.Username)
+	}
+	if user.Team != "" {
+		parts = append(parts, "team "+user.Team)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// redactAudit clears the values of the entries about a user, which may hold
+// their name or birth date; the ids and the kind of each change stay.
+func redactAudit(ctx context.Context, ex execer, telegramID int64) error {
+	query, args, err := squirrel.Update("audit_log").
+		Set("old_value", "").
+		Set("new_value", "").
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		Where(squirrel.Or{squirrel.NotEq{"old_value": ""}, squirrel.NotEq{"new_value": ""}}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = ex.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to redact audit log: %w", err)
+	}
+	return nil
+}
+
+// RecordAudit appends an entry for changes made outside the methods that
+// record their own, such as admin actions.
+func (db *Database) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+
+	ctx, cancel := db.withTimeout(ctx, "RecordAudit")
+	defer cancel()
+	return writeAudit(ctx, db.DB, entry)
+}
+
+// ListAudit returns entries about filter.TelegramID, on either side of a
+// subscription, newest first.
+func (db *Database) ListAudit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListAudit")
+	defer cancel()
+	builder := squirrel.Select(auditColumns...).From("audit_log").OrderBy("id DESC")
+	if filter.TelegramID != 0 {
+		builder = builder.Where(squirrel.Or{
+			squirrel.Eq{"telegram_id": filter.TelegramID},
+			squirrel.Eq{"related_id": filter.TelegramID},
+		})
+	}
+	if !filter.From.IsZero() {
+		builder = builder.Where(squirrel.GtOrEq{"created_at": sqliteTime(filter.From)})
+	}
+	if !filter.To.IsZero() {
+		builder = builder.Where(squirrel.LtOrEq{"created_at": sqliteTime(filter.To)})
+	}
+	if filter.Limit > 0 {
+		builder = builder.Limit(uint64(filter.Limit))
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return entries, nil
+}
+
+func scanAuditEntry(row rowScanner) (models.AuditEntry, error) {
+	var entry models.AuditEntry
+	var createdAt string
+	err := row.Scan(&entry.ID, &createdAt, &entry.Actor, &entry.Action, &entry.TelegramID, &entry.RelatedID,
+		&entry.OldValue, &entry.NewValue, &entry.Source)
+	if err != nil {
+		return entry, err
+	}
+	entry.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt)
+	return entry, err
+}
+
+// eventDate returns the date of the user's event of eventType, or "" when
+// there is none.
+func eventDate(ctx context.Context, q querier, telegramID int64, eventType string) (string, error) {
+	query, args, err := squirrel.Select("events.date").From("events").
+		Join("users ON users.id = events.user_id").
+		Where(squirrel.Eq{"users.telegram_id": telegramID, "events.type": eventType}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var date string
+	err = q.QueryRowContext(ctx, query, args...).Scan(&date)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to execute query: %w", err)
+	}
+	return date, nil
+}
+
+// userByTelegramID is FindUserByID inside a transaction; it returns
+// sql.ErrNoRows for an unknown user.
+func userByTelegramID(ctx context.Context, q querier, telegramID int) (models.ShortUserInfo, error) {
+	query, args, err := squirrel.Select(userColumns...).From("users").Where(squirrel.Eq{"telegram_id": telegramID}).ToSql()
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("failed to build query: %w", err)
+	}
+	return scanUser(q.QueryRowContext(ctx, query, args...))
+}
@@ -0,0 +1,413 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rutube/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+const backupFilePrefix = "backup-"
+
+// Snapshot copies the live database into destPath with the SQLite online
+// backup API, so it is consistent even while the bot keeps writing.
+func (db *Database) Snapshot(ctx context.Context, destPath string) error {
+	srcConn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get source connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer destDB.Close()
+
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get backup connection: %w", err)
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destRaw interface{}) error {
+		return srcConn.Raw(func(srcRaw interface{}) error {
+			dest, ok := destRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup connection is not sqlite3")
+			}
+			src, ok := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("source connection is not sqlite3")
+			}
+
+			backup, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+
+			_, err = backup.Step(-1)
+			if err != nil {
+				backup.Finish()
+				return fmt.Errorf("failed to copy database: %w", err)
+			}
+
+			return backup.Finish()
+		})
+	})
+}
+
+// CreateBackup writes a timestamped snapshot into dir and removes the oldest
+// snapshots so that at most keep files remain.
+func (db *Database) CreateBackup(ctx context.Context, dir string, keep int) (string, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, backupFilePrefix+time.Now().UTC().Format("20060102T150405Z")+".db")
+	err = db.Snapshot(ctx, path)
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+
+	err = pruneBackups(dir, keep)
+	if err != nil {
+		db.Logger.Warn("Failed to prune old backups", zap.Error(err))
+	}
+
+	return path, nil
+}
+
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupFilePrefix) && strings.HasSuffix(name, ".db") {
+			backups = append(backups, name)
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamps in the names sort lexicographically in chronological order.
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportArchive reads all tables inside one read transaction so the archive
+// reflects a single point in time.
+func (db *Database) ExportArchive(ctx context.Context) (models.Archive, error) {
+	var archive models.Archive
+
+	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return archive, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	archive.Users, err = queryAll(ctx, tx, squirrel.Select(userColumns...).From("users").OrderBy("id"), scanUser)
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Subscriptions, err = queryAll(ctx, tx, squirrel.Select(subscriptionColumns...).From("subscriptions").OrderBy("id"), scanSubscription)
+	if err != nil {
+		return archive, err
+	}
+
+	archive.CalendarTokens, err = queryAll(ctx, tx, squirrel.Select("telegram_id", "token").From("calendar_tokens").OrderBy("telegram_id"),
+		func(row rowScanner) (models.CalendarToken, error) {
+			var token models.CalendarToken
+			err := row.Scan(&token.TelegramID, &token.Token)
+			return token, err
+		})
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Wishlist, err = queryAll(ctx, tx, squirrel.Select(wishlistColumns...).From("wishlist").OrderBy("id"),
+		func(row rowScanner) (models.WishlistItem, error) {
+			var item models.WishlistItem
+			err := row.Scan(&item.ID, &item.TelegramID, &item.Text, &item.URL)
+			return item, err
+		})
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Events, err = queryAll(ctx, tx, squirrel.Select(eventColumns...).From("events").
+		Join("users ON users.id = events.user_id").
+		OrderBy("events.id"), scanEvent)
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Settings, err = queryAll(ctx, tx, squirrel.Select(settingsColumns...).From("user_settings").OrderBy("telegram_id"), scanSettings)
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Funds, err = queryAll(ctx, tx, squirrel.Select(fundColumns...).From("funds").OrderBy("id"), scanFund)
+	if err != nil {
+		return archive, err
+	}
+
+	archive.Contributions, err = queryAll(ctx, tx, squirrel.Select("fund_id", "telegram_id", "amount", "paid").From("fund_contributions").
+		OrderBy("updated_at", "fund_id", "telegram_id"),
+		func(row rowScanner) (models.Contribution, error) {
+			var contribution models.Contribution
+			err := row.Scan(&contribution.FundID, &contribution.TelegramID, &contribution.Amount, &contribution.Paid)
+			return contribution, err
+		})
+	if err != nil {
+		return archive, err
+	}
+
+	archive.PendingBirthdays, err = queryAll(ctx, tx, squirrel.Select("telegram_id", "birth_date", "source", "created_at").From("pending_birthdays").
+		OrderBy("telegram_id"),
+		func(row rowScanner) (models.PendingBirthday, error) {
+			var pending models.PendingBirthday
+			var createdAt string
+			if err := row.Scan(&pending.TelegramID, &pending.BirthDate, &pending.Source, &createdAt); err != nil {
+				return pending, err
+			}
+			pending.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt)
+			return pending, err
+		})
+	if err != nil {
+		return archive, err
+	}
+
+	archive.AuditLog, err = queryAll(ctx, tx, squirrel.Select(auditColumns...).From("audit_log").OrderBy("id"), scanAuditEntry)
+	if err != nil {
+		return archive, err
+	}
+
+	return archive, nil
+}
+
+// queryAll runs the query and scans every row; the result is never nil, so
+// empty tables are exported as empty lists.
+func queryAll[T any](ctx context.Context, tx *sql.Tx, builder squirrel.SelectBuilder, scan func(rowScanner) (T, error)) ([]T, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	result := []T{}
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return result, nil
+}
+
+// RestoreArchive loads an archive into an empty database, keeping row ids.
+func (db *Database) RestoreArchive(ctx context.Context, archive models.Archive) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM subscriptions) + (SELECT COUNT(*) FROM audit_log)").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check database is empty: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("database is not empty, restore is only allowed into an empty database")
+	}
+
+	birthdayEvents := make(map[int]bool)
+	for _, event := range archive.Events {
+		if event.Type == models.EventBirthday {
+			birthdayEvents[event.UserID] = true
+		}
+	}
+
+	for _, user := range archive.Users {
+		query, args, err := squirrel.Insert("users").
+			Columns("id", "telegram_id", "first_name", "last_name", "username", "bio_sync", "active", "team").
+			Values(user.ID, nullableTelegramID(user.IDTG), user.FirstName, user.LastName, nullableUsername(user.Username), user.BioSync, !user.Inactive, user.Team).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore user %d: %w", user.ID, err)
+		}
+
+		// Archives before version 3 carry birthdays only on the user; later
+		// ones also have the birthday event, which is restored below.
+		if user.BirthDate != "" && !birthdayEvents[user.ID] {
+			if _, err := setBirthday(ctx, tx, "id", user.ID, user.BirthDate, user.BirthdaySource); err != nil {
+				return fmt.Errorf("failed to restore birthday of user %d: %w", user.ID, err)
+			}
+		}
+	}
+
+	for _, sub := range archive.Subscriptions {
+		query, args, err := squirrel.Insert("subscriptions").
+			Columns(subscriptionColumns...).
+			Values(sub.ID, sub.SubscriberID, sub.SubscribedToID, strings.Join(sub.EventTypes, ",")).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore subscription %d: %w", sub.ID, err)
+		}
+	}
+
+	for _, token := range archive.CalendarTokens {
+		query, args, err := squirrel.Insert("calendar_tokens").
+			Columns("telegram_id", "token").
+			Values(token.TelegramID, token.Token).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore calendar token of %d: %w", token.TelegramID, err)
+		}
+	}
+
+	for _, item := range archive.Wishlist {
+		query, args, err := squirrel.Insert("wishlist").
+			Columns(wishlistColumns...).
+			Values(item.ID, item.TelegramID, item.Text, item.URL).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore wishlist item %d: %w", item.ID, err)
+		}
+	}
+
+	for _, event := range archive.Events {
+		query, args, err := squirrel.Insert("events").Options("OR REPLACE").
+			Columns("id", "user_id", "type", "date", "recurrence", "visibility", "source").
+			Values(event.ID, event.UserID, event.Type, event.Date, event.Recurrence, event.Visibility, event.Source).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore event %d: %w", event.ID, err)
+		}
+	}
+
+	for _, settings := range archive.Settings {
+		query, args, err := insertSettings(settings).ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore settings of %d: %w", settings.TelegramID, err)
+		}
+	}
+
+	for _, fund := range archive.Funds {
+		closedAt := squirrel.Expr("NULL")
+		if fund.Closed {
+			closedAt = squirrel.Expr("CURRENT_TIMESTAMP")
+		}
+		query, args, err := squirrel.Insert("funds").
+			Columns("id", "birthday_id", "organiser_id", "date", "closed_at").
+			Values(fund.ID, fund.BirthdayID, fund.OrganiserID, fund.Date, closedAt).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore fund %d: %w", fund.ID, err)
+		}
+	}
+
+	for _, contribution := range archive.Contributions {
+		query, args, err := squirrel.Insert("fund_contributions").
+			Columns("fund_id", "telegram_id", "amount", "paid").
+			Values(contribution.FundID, contribution.TelegramID, contribution.Amount, contribution.Paid).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore contribution of %d to fund %d: %w", contribution.TelegramID, contribution.FundID, err)
+		}
+	}
+
+	for _, pending := range archive.PendingBirthdays {
+		query, args, err := squirrel.Insert("pending_birthdays").
+			Columns("telegram_id", "birth_date", "source", "created_at").
+			Values(pending.TelegramID, pending.BirthDate, pending.Source, sqliteTime(pending.CreatedAt)).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore pending birthday of %d: %w", pending.TelegramID, err)
+		}
+	}
+
+	// Entries keep their ids and times, so the restored log reads as before
+	// and new entries follow it.
+	for _, entry := range archive.AuditLog {
+		query, args, err := squirrel.Insert("audit_log").
+			Columns(auditColumns...).
+			Values(entry.ID, sqliteTime(entry.CreatedAt), entry.Actor, entry.Action, entry.TelegramID, entry.RelatedID,
+				entry.OldValue, entry.NewValue, entry.Source).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to restore audit entry %d: %w", entry.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"rutube/models"
+)
+
+// TestArchiveRoundTrip restores an export into an empty database and checks
+// that exporting it again gives the same data.
+func TestArchiveRoundTrip(t *testing.T) {
+	src := openTestDatabase(t, Options{MaxOpenConns: 1})
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2, 3} {
+		err := src.InsertUser(ctx, models.ShortUserInfo{IDTG: id, FirstName: "User", BirthDate: "1990-05-10"})
+		if err != nil {
+			t.Fatalf("InsertUser: %v", err)
+		}
+	}
+	if err := src.SubscribeToBirthday(ctx, 2, 1); err != nil {
+		t.Fatalf("SubscribeToBirthday: %v", err)
+	}
+
+	open, _, err := src.OpenFund(ctx, 1, 2, "2030-05-10")
+	if err != nil {
+		t.Fatalf("OpenFund: %v", err)
+	}
+	closed, _, err := src.OpenFund(ctx, 1, 3, "2029-05-10")
+	if err != nil {
+		t.Fatalf("OpenFund: %v", err)
+	}
+	if err := src.CloseFund(ctx, closed.ID); err != nil {
+		t.Fatalf("CloseFund: %v", err)
+	}
+	if err := src.SetContribution(ctx, open.ID, 2, 500); err != nil {
+		t.Fatalf("SetContribution: %v", err)
+	}
+	if _, err := src.MarkContributionPaid(ctx, open.ID, 2); err != nil {
+		t.Fatalf("MarkContributionPaid: %v", err)
+	}
+	if err := src.SetContribution(ctx, open.ID, 3, 300); err != nil {
+		t.Fatalf("SetContribution: %v", err)
+	}
+
+	pending := models.PendingBirthday{TelegramID: 3, BirthDate: "1991-01-02", Source: models.BirthdaySourceBio}
+	if err := src.SetPendingBirthday(ctx, pending); err != nil {
+		t.Fatalf("SetPendingBirthday: %v", err)
+	}
+
+	want, err := src.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive: %v", err)
+	}
+	if len(want.Funds) != 2 || len(want.Contributions) != 2 || len(want.PendingBirthdays) != 1 || len(want.AuditLog) == 0 {
+		t.Fatalf("export is missing data: %d funds, %d contributions, %d pending birthdays, %d audit entries",
+			len(want.Funds), len(want.Contributions), len(want.PendingBirthdays), len(want.AuditLog))
+	}
+
+	dst := openTestDatabase(t, Options{MaxOpenConns: 1})
+	if err := dst.RestoreArchive(ctx, want); err != nil {
+		t.Fatalf("RestoreArchive: %v", err)
+	}
+	if err := dst.RestoreArchive(ctx, want); err == nil {
+		t.Fatal("RestoreArchive into a non-empty database succeeded")
+	}
+
+	got, err := dst.ExportArchive(ctx)
+	if err != nil {
+		t.Fatalf("ExportArchive: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("restored archive differs:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+// TestRestoreArchiveBirthdayOnUser covers archives before version 3, which
+// have no events and carry the birthday on the user.
+func TestRestoreArchiveBirthdayOnUser(t *testing.T) {
+	db := openTestDatabase(t, Options{MaxOpenConns: 1})
+	ctx := context.Background()
+
+	archive := models.Archive{
+		Version: 2,
+		Users: []models.ShortUserInfo{
+			{ID: 7, IDTG: 1, FirstName: "User", BirthDate: "1990-05-10", BirthdaySource: models.BirthdaySourceManual},
+		},
+	}
+	if err := db.RestoreArchive(ctx, archive); err != nil {
+		t.Fatalf("RestoreArchive: %v", err)
+	}
+
+	events, err := db.ListEvents(ctx, 1)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != models.EventBirthday || events[0].Date != "1990-05-10" {
+		t.Fatalf("restored events = %+v, want the birthday", events)
+	}
+}
@@ -19,3 +19,189 @@ const (
 		FOREIGN KEY(subscribed_to_id) REFERENCES users(telegram_id)
 	);`
 )
+
+// migrations are applied in order on top of the base tables above; the index
+// of the last applied migration is kept in PRAGMA user_version.
+var migrations = []string{
+	`ALTER TABLE users ADD COLUMN username TEXT;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(username);`,
+
+	`CREATE TABLE IF NOT EXISTS calendar_tokens (
+		telegram_id INTEGER NOT NULL PRIMARY KEY,
+		token TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`,
+
+	// SQLite cannot alter foreign keys, so both child tables are rebuilt with
+	// cascading references. Orphaned and duplicate rows are dropped on the way.
+	`CREATE TABLE subscriptions_new (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		subscriber_id INTEGER NOT NULL,
+		subscribed_to_id INTEGER NOT NULL,
+		UNIQUE(subscriber_id, subscribed_to_id),
+		FOREIGN KEY(subscriber_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE,
+		FOREIGN KEY(subscribed_to_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);
+	INSERT OR IGNORE INTO subscriptions_new (id, subscriber_id, subscribed_to_id)
+		SELECT id, subscriber_id, subscribed_to_id FROM subscriptions
+		WHERE subscriber_id IN (SELECT telegram_id FROM users)
+		AND subscribed_to_id IN (SELECT telegram_id FROM users);
+	DROP TABLE subscriptions;
+	ALTER TABLE subscriptions_new RENAME TO subscriptions;
+
+	CREATE TABLE calendar_tokens_new (
+		telegram_id INTEGER NOT NULL PRIMARY KEY,
+		token TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);
+	INSERT INTO calendar_tokens_new (telegram_id, token, created_at)
+		SELECT telegram_id, token, created_at FROM calendar_tokens
+		WHERE telegram_id IN (SELECT telegram_id FROM users);
+	DROP TABLE calendar_tokens;
+	ALTER TABLE calendar_tokens_new RENAME TO calendar_tokens;`,
+
+	// outbox holds messages waiting to be delivered by the sender worker.
+	// dedup_key lets producers such as the reminder job enqueue idempotently.
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		dedup_key TEXT UNIQUE,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		sent_at TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox(status, next_attempt_at);`,
+
+	`ALTER TABLE users ADD COLUMN active INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE users ADD COLUMN active_changed_at TEXT;`,
+
+	// Birthdays stored before sources were tracked are treated as manual, so
+	// the profile sync never replaces them silently.
+	`ALTER TABLE users ADD COLUMN birthday_source TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN bio_sync INTEGER NOT NULL DEFAULT 0;
+	UPDATE users SET birthday_source = 'manual' WHERE birth_date IS NOT NULL AND birth_date != '';`,
+
+	// pending_birthdays holds dates detected automatically until the user
+	// confirms them.
+	`CREATE TABLE IF NOT EXISTS pending_birthdays (
+		telegram_id INTEGER NOT NULL PRIMARY KEY,
+		birth_date TEXT NOT NULL,
+		source TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);`,
+
+	// A fund collects money for one birthday; date is that occurrence, so
+	// there is at most one collection per person per year.
+	`CREATE TABLE IF NOT EXISTS funds (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		birthday_id INTEGER NOT NULL,
+		organiser_id INTEGER NOT NULL,
+		date TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		closed_at TEXT,
+		UNIQUE(birthday_id, date),
+		FOREIGN KEY(birthday_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE,
+		FOREIGN KEY(organiser_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS fund_contributions (
+		fund_id INTEGER NOT NULL,
+		telegram_id INTEGER NOT NULL,
+		amount INTEGER NOT NULL,
+		paid INTEGER NOT NULL DEFAULT 0,
+		updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(fund_id, telegram_id),
+		FOREIGN KEY(fund_id) REFERENCES funds(id) ON DELETE CASCADE,
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);`,
+
+	`CREATE TABLE IF NOT EXISTS wishlist (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		telegram_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		url TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_wishlist_user ON wishlist(telegram_id);`,
+
+	// Birthdays move from users into events, which also hold work
+	// anniversaries and name days. Events reference users.id rather than
+	// telegram_id so users imported without a Telegram account keep theirs.
+	`CREATE TABLE IF NOT EXISTS events (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		date TEXT NOT NULL,
+		recurrence TEXT NOT NULL DEFAULT 'yearly',
+		visibility TEXT NOT NULL DEFAULT 'public',
+		source TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(user_id, type),
+		FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO events (user_id, type, date, source)
+		SELECT id, 'birthday', birth_date, birthday_source FROM users
+		WHERE birth_date IS NOT NULL AND birth_date != '';
+	ALTER TABLE users DROP COLUMN birth_date;
+	ALTER TABLE users DROP COLUMN birthday_source;
+	ALTER TABLE subscriptions ADD COLUMN event_types TEXT NOT NULL DEFAULT '';`,
+
+	`ALTER TABLE users ADD COLUMN team TEXT NOT NULL DEFAULT '';`,
+
+	`CREATE TABLE IF NOT EXISTS user_settings (
+		telegram_id INTEGER NOT NULL PRIMARY KEY,
+		digest_weekly INTEGER NOT NULL DEFAULT 0,
+		digest_monthly INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(telegram_id) REFERENCES users(telegram_id) ON DELETE CASCADE ON UPDATE CASCADE
+	);`,
+
+	// A NULL reminder_offsets follows the bot's configuration, an empty one
+	// turns advance reminders off.
+	`ALTER TABLE user_settings ADD COLUMN language TEXT NOT NULL DEFAULT 'ru';
+	ALTER TABLE user_settings ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+	ALTER TABLE user_settings ADD COLUMN notify_hour INTEGER NOT NULL DEFAULT -1;
+	ALTER TABLE user_settings ADD COLUMN reminder_offsets TEXT;
+	ALTER TABLE user_settings ADD COLUMN privacy TEXT NOT NULL DEFAULT 'public';
+	ALTER TABLE user_settings ADD COLUMN quiet_from INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE user_settings ADD COLUMN quiet_to INTEGER NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE user_settings ADD COLUMN vacation_from TEXT NOT NULL DEFAULT '';
+	ALTER TABLE user_settings ADD COLUMN vacation_to TEXT NOT NULL DEFAULT '';
+	ALTER TABLE outbox ADD COLUMN deferred INTEGER NOT NULL DEFAULT 0;`,
+
+	// audit_log has no foreign keys so entries outlive the users they are
+	// about; the triggers keep it append-only.
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL,
+		action TEXT NOT NULL,
+		telegram_id INTEGER NOT NULL DEFAULT 0,
+		related_id INTEGER NOT NULL DEFAULT 0,
+		old_value TEXT NOT NULL DEFAULT '',
+		new_value TEXT NOT NULL DEFAULT '',
+		source TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(telegram_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_related ON audit_log(related_id, created_at);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+
+	// The only update allowed is clearing the values of an entry, which
+	// DeleteUser does for the entries about a forgotten user.
+	`DROP TRIGGER IF EXISTS audit_log_no_update;
+	CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+	WHEN NOT (NEW.old_value = '' AND NEW.new_value = ''
+		AND NEW.id = OLD.id AND NEW.created_at = OLD.created_at AND NEW.actor = OLD.actor
+		AND NEW.action = OLD.action AND NEW.telegram_id = OLD.telegram_id
+		AND NEW.related_id = OLD.related_id AND NEW.source = OLD.source)
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END;`,
+}
@@ -1,15 +1,72 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"rutube/infrastructure/metrics"
 	"rutube/models"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/squirrel"
 	_ "github.com/mattn/go-sqlite3"
 	"go.uber.org/zap"
 )
 
+var userColumns = []string{
+	"id",
+	"COALESCE(telegram_id, 0)",
+	"COALESCE(first_name, '')",
+	"COALESCE(last_name, '')",
+	"COALESCE((SELECT date FROM events WHERE events.user_id = users.id AND events.type = 'birthday'), '')",
+	"COALESCE(username, '')",
+	"COALESCE((SELECT source FROM events WHERE events.user_id = users.id AND events.type = 'birthday'), '')",
+	"bio_sync = 1",
+	"active = 0",
+	"team",
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+var subscriptionColumns = []string{"id", "subscriber_id", "subscribed_to_id", "event_types"}
+
+func scanSubscription(row rowScanner) (models.Subscription, error) {
+	var sub models.Subscription
+	var eventTypes string
+	err := row.Scan(&sub.ID, &sub.SubscriberID, &sub.SubscribedToID, &eventTypes)
+	if eventTypes != "" {
+		sub.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return sub, err
+}
+
+func scanUser(row rowScanner) (models.ShortUserInfo, error) {
+	var user models.ShortUserInfo
+	err := row.Scan(&user.ID, &user.IDTG, &user.FirstName, &user.LastName, &user.BirthDate, &user.Username, &user.BirthdaySource, &user.BioSync, &user.Inactive, &user.Team)
+	return user, err
+}
+
+// nullableTelegramID stores users imported without a Telegram account as NULL,
+// so the UNIQUE constraint on telegram_id does not clash between them.
+func nullableTelegramID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullableUsername(username string) interface{} {
+	if username == "" {
+		return nil
+	}
+	return username
+}
+
+const queryTimeout = 5 * time.Second
+
 type Database struct {
 	Logger *zap.Logger
 	DB     *sql.DB
@@ -24,16 +81,36 @@ func NewDatabase(logger *zap.Logger, db *sql.DB) *Database {
 
 }
 
-func (db *Database) FindUserByID(userID int) (models.ShortUserInfo, error) {
-	query, args, err := squirrel.Select("*").From("users").Where(squirrel.Eq{"telegram_id": userID}).ToSql()
+// withTimeout bounds a single repository operation so a stuck query cannot
+// outlive the request or job that issued it. The returned cancel func also
+// records the operation duration.
+func (db *Database) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	return ctx, func() {
+		cancel()
+		metrics.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (db *Database) Ping(ctx context.Context) error {
+
+	ctx, cancel := db.withTimeout(ctx, "Ping")
+	defer cancel()
+	return db.DB.PingContext(ctx)
+}
+
+func (db *Database) FindUserByID(ctx context.Context, userID int) (models.ShortUserInfo, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "FindUserByID")
+	defer cancel()
+	query, args, err := squirrel.Select(userColumns...).From("users").Where(squirrel.Eq{"telegram_id": userID}).ToSql()
 	if err != nil {
 		db.Logger.Error("Error building SQL query", zap.Error(err))
 		return models.ShortUserInfo{}, err
 	}
 
-	var user models.ShortUserInfo
-
-	err = db.DB.QueryRow(query, args...).Scan(&user.ID, &user.IDTG, &user.FirstName, &user.LastName, &user.BirthDate)
+	user, err := scanUser(db.DB.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.ShortUserInfo{}, nil // Пользователь не найден
@@ -46,70 +123,103 @@ func (db *Database) FindUserByID(userID int) (models.ShortUserInfo, error) {
 	return user, nil
 }
 
-func (db *Database) UpdateUserBirthDate(telegramID int, newBirthDate string) error {
+func (db *Database) UpdateUserBirthDate(ctx context.Context, telegramID int, newBirthDate string, source string) error {
 
-	query, args, err := squirrel.Update("users").
-		Set("birth_date", newBirthDate).
-		Where(squirrel.Eq{"telegram_id": telegramID}).
-		ToSql()
+	ctx, cancel := db.withTimeout(ctx, "UpdateUserBirthDate")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to build query: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	stmt, err := db.DB.Prepare(query)
+	oldBirthDate, err := eventDate(ctx, tx, int64(telegramID), models.EventBirthday)
 	if err != nil {
-		return fmt.Errorf("failed to prepare query: %w", err)
-	}
-	defer stmt.Close()
-
-	res, err := stmt.Exec(args...)
-	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+		return err
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	rowsAffected, err := setBirthday(ctx, tx, "telegram_id", telegramID, newBirthDate, source)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve affected rows: %w", err)
+		return err
 	}
 	if rowsAffected == 0 {
 		return fmt.Errorf("no user found with telegram_id: %d", telegramID)
 	}
 
+	err = auditEventChange(ctx, tx, int64(telegramID), models.EventBirthday, oldBirthDate, newBirthDate, source)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (db *Database) InsertUser(userInfo models.ShortUserInfo) error {
+func (db *Database) InsertUser(ctx context.Context, userInfo models.ShortUserInfo) error {
+
+	ctx, cancel := db.withTimeout(ctx, "InsertUser")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	query, args, err := squirrel.Insert("users").
-		Columns("telegram_id", "first_name", "last_name", "birth_date").
-		Values(userInfo.IDTG, userInfo.FirstName, userInfo.LastName, userInfo.BirthDate).
+		Columns("telegram_id", "first_name", "last_name", "username", "team").
+		Values(nullableTelegramID(userInfo.IDTG), userInfo.FirstName, userInfo.LastName, nullableUsername(userInfo.Username), userInfo.Team).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	stmt, err := db.DB.Prepare(query)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("failed to prepare query: %w", err)
+		return fmt.Errorf("failed to get inserted id: %w", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(args...)
+	err = writeAudit(ctx, tx, models.AuditEntry{
+		Action:     models.AuditUserCreated,
+		TelegramID: int64(userInfo.IDTG),
+		NewValue:   userSummary(userInfo),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to execute query: %w", err)
+		return err
 	}
 
+	if userInfo.BirthDate != "" {
+		if _, err := setBirthday(ctx, tx, "id", id, userInfo.BirthDate, userInfo.BirthdaySource); err != nil {
+			return err
+		}
+		err = auditEventChange(ctx, tx, int64(userInfo.IDTG), models.EventBirthday, "", userInfo.BirthDate, userInfo.BirthdaySource)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (db *Database) SetAllUser() ([]models.ShortUserInfo, error) {
+func (db *Database) SetAllUser(ctx context.Context) ([]models.ShortUserInfo, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "SetAllUser")
+	defer cancel()
 
-	query, args, err := squirrel.Select("*").From("users").ToSql()
+	query, args, err := squirrel.Select(userColumns...).From("users").ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	rows, err := db.DB.Query(query, args...)
+	rows, err := db.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -117,8 +227,7 @@ func (db *Database) SetAllUser() ([]models.ShortUserInfo, error) {
 
 	var users []models.ShortUserInfo
 	for rows.Next() {
-		var user models.ShortUserInfo
-		err := rows.Scan(&user.ID, &user.IDTG, &user.FirstName, &user.LastName, &user.BirthDate)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
@@ -133,7 +242,16 @@ func (db *Database) SetAllUser() ([]models.ShortUserInfo, error) {
 
 }
 
-func (db *Database) SubscribeToBirthday(subscriberID, subscribedToID int64) error {
+func (db *Database) SubscribeToBirthday(ctx context.Context, subscriberID, subscribedToID int64) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SubscribeToBirthday")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query, args, err := squirrel.Insert("subscriptions").
 		Columns("subscriber_id", "subscribed_to_id").
 		Values(subscriberID, subscribedToID).
@@ -143,16 +261,37 @@ func (db *Database) SubscribeToBirthday(subscriberID, subscribedToID int64) erro
 		return err
 	}
 
-	_, err = db.DB.Exec(query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		db.Logger.Error("Error executing query", zap.Error(err))
 		return err
 	}
 
+	err = writeAudit(ctx, tx, models.AuditEntry{
+		Action:     models.AuditSubscribed,
+		TelegramID: subscriberID,
+		RelatedID:  subscribedToID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (db *Database) UnsubscribeFromBirthday(subscriberID, subscribedToID int64) error {
+func (db *Database) UnsubscribeFromBirthday(ctx context.Context, subscriberID, subscribedToID int64) error {
+
+	ctx, cancel := db.withTimeout(ctx, "UnsubscribeFromBirthday")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query, args, err := squirrel.Delete("subscriptions").
 		Where(squirrel.Eq{"subscriber_id": subscriberID, "subscribed_to_id": subscribedToID}).
 		ToSql()
@@ -161,16 +300,97 @@ func (db *Database) UnsubscribeFromBirthday(subscriberID, subscribedToID int64)
 		return err
 	}
 
-	_, err = db.DB.Exec(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		db.Logger.Error("Error executing query", zap.Error(err))
 		return err
 	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected > 0 {
+		err = writeAudit(ctx, tx, models.AuditEntry{
+			Action:     models.AuditUnsubscribed,
+			TelegramID: subscriberID,
+			RelatedID:  subscribedToID,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (db *Database) IsSubscribed(subscriberID, subscribedToID int64) (bool, error) {
+// SetSubscriptionEventTypes limits an existing subscription to the given
+// event types; an empty list means all of them.
+func (db *Database) SetSubscriptionEventTypes(ctx context.Context, subscriberID, subscribedToID int64, eventTypes []string) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetSubscriptionEventTypes")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where := squirrel.Eq{"subscriber_id": subscriberID, "subscribed_to_id": subscribedToID}
+	query, args, err := squirrel.Select("event_types").From("subscriptions").Where(where).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var oldTypes string
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&oldTypes)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	newTypes := strings.Join(eventTypes, ",")
+	query, args, err = squirrel.Update("subscriptions").
+		Set("event_types", newTypes).
+		Where(where).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	if oldTypes != newTypes {
+		err = writeAudit(ctx, tx, models.AuditEntry{
+			Action:     models.AuditSubscriptionChanged,
+			TelegramID: subscriberID,
+			RelatedID:  subscribedToID,
+			OldValue:   oldTypes,
+			NewValue:   newTypes,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) IsSubscribed(ctx context.Context, subscriberID, subscribedToID int64) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "IsSubscribed")
+	defer cancel()
 	query, args, err := squirrel.Select("COUNT(*)").From("subscriptions").
 		Where(squirrel.Eq{"subscriber_id": subscriberID, "subscribed_to_id": subscribedToID}).
 		ToSql()
@@ -180,7 +400,7 @@ func (db *Database) IsSubscribed(subscriberID, subscribedToID int64) (bool, erro
 	}
 
 	var count int
-	err = db.DB.QueryRow(query, args...).Scan(&count)
+	err = db.DB.QueryRowContext(ctx, query, args...).Scan(&count)
 	if err != nil {
 		db.Logger.Error("Error executing query", zap.Error(err))
 		return false, err
@@ -188,3 +408,580 @@ func (db *Database) IsSubscribed(subscriberID, subscribedToID int64) (bool, erro
 
 	return count > 0, nil
 }
+
+func (db *Database) UpdateUser(ctx context.Context, userInfo models.ShortUserInfo) error {
+
+	ctx, cancel := db.withTimeout(ctx, "UpdateUser")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	existing, err := userByTelegramID(ctx, tx, userInfo.IDTG)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no user found with telegram_id: %d", userInfo.IDTG)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	query, args, err := squirrel.Update("users").
+		Set("first_name", userInfo.FirstName).
+		Set("last_name", userInfo.LastName).
+		Set("username", nullableUsername(userInfo.Username)).
+		Set("team", userInfo.Team).
+		Where(squirrel.Eq{"telegram_id": userInfo.IDTG}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user found with telegram_id: %d", userInfo.IDTG)
+	}
+
+	if userSummary(existing) != userSummary(userInfo) {
+		err = writeAudit(ctx, tx, models.AuditEntry{
+			Action:     models.AuditUserUpdated,
+			TelegramID: int64(userInfo.IDTG),
+			OldValue:   userSummary(existing),
+			NewValue:   userSummary(userInfo),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = setBirthday(ctx, tx, "telegram_id", userInfo.IDTG, userInfo.BirthDate, userInfo.BirthdaySource)
+	if err != nil {
+		return err
+	}
+	err = auditEventChange(ctx, tx, int64(userInfo.IDTG), models.EventBirthday, existing.BirthDate, userInfo.BirthDate, userInfo.BirthdaySource)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteUser relies on ON DELETE CASCADE to remove the user's subscriptions
+// in both directions and the calendar token. Pending messages to and about
+// the user are deleted in the same transaction, and the values of the audit
+// entries about them are cleared.
+func (db *Database) DeleteUser(ctx context.Context, telegramID int) error {
+
+	ctx, cancel := db.withTimeout(ctx, "DeleteUser")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = userByTelegramID(ctx, tx, telegramID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	err = deleteUserMessages(ctx, tx, int64(telegramID))
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.Delete("users").Where(squirrel.Eq{"telegram_id": telegramID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	err = redactAudit(ctx, tx, int64(telegramID))
+	if err != nil {
+		return err
+	}
+
+	err = writeAudit(ctx, tx, models.AuditEntry{
+		Action:     models.AuditUserDeleted,
+		TelegramID: int64(telegramID),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (db *Database) ListSubscriptions(ctx context.Context, subscriberID int64) ([]models.Subscription, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListSubscriptions")
+	defer cancel()
+	builder := squirrel.Select(subscriptionColumns...).From("subscriptions").OrderBy("id")
+	if subscriberID != 0 {
+		builder = builder.Where(squirrel.Eq{"subscriber_id": subscriberID})
+	}
+
+	return db.querySubscriptions(ctx, builder)
+}
+
+// ListUserSubscriptions returns subscriptions where the user is either the
+// subscriber or the one subscribed to.
+func (db *Database) ListUserSubscriptions(ctx context.Context, telegramID int64) ([]models.Subscription, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListUserSubscriptions")
+	defer cancel()
+	builder := squirrel.Select(subscriptionColumns...).From("subscriptions").
+		Where(squirrel.Or{
+			squirrel.Eq{"subscriber_id": telegramID},
+			squirrel.Eq{"subscribed_to_id": telegramID},
+		}).
+		OrderBy("id")
+
+	return db.querySubscriptions(ctx, builder)
+}
+
+func (db *Database) querySubscriptions(ctx context.Context, builder squirrel.SelectBuilder) ([]models.Subscription, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (db *Database) FindUserByUsername(ctx context.Context, username string) (models.ShortUserInfo, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "FindUserByUsername")
+	defer cancel()
+	query, args, err := squirrel.Select(userColumns...).From("users").Where(squirrel.Eq{"username": username}).ToSql()
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	user, err := scanUser(db.DB.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.ShortUserInfo{}, nil
+		}
+		return models.ShortUserInfo{}, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return user, nil
+}
+
+// LinkTelegramID attaches a Telegram account to a user imported without one.
+// It reports false when the row already belongs to an account: usernames
+// change hands, and relinking would move that account's data.
+func (db *Database) LinkTelegramID(ctx context.Context, userID int, telegramID int) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "LinkTelegramID")
+	defer cancel()
+	query, args, err := squirrel.Update("users").
+		Set("telegram_id", telegramID).
+		Where(squirrel.Eq{"id": userID, "telegram_id": nil}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (db *Database) CountUsers(ctx context.Context) (int, error) {
+	return db.count(ctx, "CountUsers", "users")
+}
+
+func (db *Database) CountSubscriptions(ctx context.Context) (int, error) {
+	return db.count(ctx, "CountSubscriptions", "subscriptions")
+}
+
+func (db *Database) count(ctx context.Context, operation string, table string) (int, error) {
+
+	ctx, cancel := db.withTimeout(ctx, operation)
+	defer cancel()
+	query, args, err := squirrel.Select("COUNT(*)").From(table).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var count int
+	err = db.DB.QueryRowContext(ctx, query, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count %s: %w", table, err)
+	}
+
+	return count, nil
+}
+
+// UpdateProfile refreshes the names and username mirrored from Telegram. A
+// username already held by another row is left unchanged.
+func (db *Database) UpdateProfile(ctx context.Context, telegramID int, firstName, lastName, username string) error {
+
+	ctx, cancel := db.withTimeout(ctx, "UpdateProfile")
+	defer cancel()
+	query, args, err := squirrel.Update("users").
+		Set("first_name", firstName).
+		Set("last_name", lastName).
+		Set("username", squirrel.Expr(`CASE
+			WHEN ? = '' THEN NULL
+			WHEN EXISTS (SELECT 1 FROM users other WHERE other.username = ? AND other.telegram_id IS NOT ?) THEN username
+			ELSE ? END`, username, username, telegramID, username)).
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (db *Database) SetBioSync(ctx context.Context, telegramID int, enabled bool) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetBioSync")
+	defer cancel()
+	query, args, err := squirrel.Update("users").
+		Set("bio_sync", enabled).
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// SetUserActive records whether the bot can reach the user. It reports false
+// when the status was already the requested one.
+func (db *Database) SetUserActive(ctx context.Context, telegramID int, active bool) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "SetUserActive")
+	defer cancel()
+	query, args, err := squirrel.Update("users").
+		Set("active", active).
+		Set("active_changed_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		Where(squirrel.NotEq{"active": active}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// UpsertUser matches an existing user by telegram_id first and by username
+// second. Empty fields of userInfo never overwrite stored values.
+func (db *Database) UpsertUser(ctx context.Context, userInfo models.ShortUserInfo) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "UpsertUser")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var conditions squirrel.Or
+	if userInfo.IDTG != 0 {
+		conditions = append(conditions, squirrel.Eq{"telegram_id": userInfo.IDTG})
+	}
+	// A username only matches a row without an account of its own; a row
+	// that belongs to another telegram_id is never taken over.
+	if userInfo.Username != "" && userInfo.IDTG != 0 {
+		conditions = append(conditions, squirrel.Eq{"username": userInfo.Username, "telegram_id": nil})
+	} else if userInfo.Username != "" {
+		conditions = append(conditions, squirrel.Eq{"username": userInfo.Username})
+	}
+	if len(conditions) == 0 {
+		return false, fmt.Errorf("telegram_id or username is required")
+	}
+
+	query, args, err := squirrel.Select(userColumns...).From("users").
+		Where(conditions).
+		OrderBy(fmt.Sprintf("telegram_id = %d DESC", userInfo.IDTG)).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	existing, err := scanUser(tx.QueryRowContext(ctx, query, args...))
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	created := err == sql.ErrNoRows
+	if created && userInfo.IDTG != 0 && userInfo.Username != "" {
+		query, args, err = squirrel.Select("COUNT(*)").From("users").
+			Where(squirrel.Eq{"username": userInfo.Username}).
+			ToSql()
+		if err != nil {
+			return false, fmt.Errorf("failed to build query: %w", err)
+		}
+		var taken int
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&taken); err != nil {
+			return false, fmt.Errorf("failed to execute query: %w", err)
+		}
+		if taken > 0 {
+			return false, fmt.Errorf("username @%s belongs to another telegram_id", userInfo.Username)
+		}
+	}
+	if created {
+		query, args, err = squirrel.Insert("users").
+			Columns("telegram_id", "first_name", "last_name", "username", "team").
+			Values(nullableTelegramID(userInfo.IDTG), userInfo.FirstName, userInfo.LastName, nullableUsername(userInfo.Username), userInfo.Team).
+			ToSql()
+	} else {
+		update := squirrel.Update("users").Where(squirrel.Eq{"id": existing.ID})
+		if userInfo.IDTG != 0 {
+			update = update.Set("telegram_id", userInfo.IDTG)
+		}
+		if userInfo.Username != "" {
+			update = update.Set("username", userInfo.Username)
+		}
+		if userInfo.FirstName != "" {
+			update = update.Set("first_name", userInfo.FirstName)
+		}
+		if userInfo.LastName != "" {
+			update = update.Set("last_name", userInfo.LastName)
+		}
+		if userInfo.Team != "" {
+			update = update.Set("team", userInfo.Team)
+		}
+		query, args, err = update.ToSql()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	merged := existing
+	if userInfo.IDTG != 0 {
+		merged.IDTG = userInfo.IDTG
+	}
+	if userInfo.Username != "" {
+		merged.Username = userInfo.Username
+	}
+	if userInfo.FirstName != "" {
+		merged.FirstName = userInfo.FirstName
+	}
+	if userInfo.LastName != "" {
+		merged.LastName = userInfo.LastName
+	}
+	if userInfo.Team != "" {
+		merged.Team = userInfo.Team
+	}
+
+	entry := models.AuditEntry{
+		Action:     models.AuditUserUpdated,
+		TelegramID: int64(merged.IDTG),
+		OldValue:   userSummary(existing),
+		NewValue:   userSummary(merged),
+		Source:     userInfo.BirthdaySource,
+	}
+	if created {
+		entry.Action, entry.OldValue = models.AuditUserCreated, ""
+	}
+	if created || entry.OldValue != entry.NewValue || existing.IDTG != merged.IDTG {
+		if err := writeAudit(ctx, tx, entry); err != nil {
+			return false, err
+		}
+	}
+
+	if userInfo.BirthDate != "" && userInfo.BirthDate != existing.BirthDate {
+		id := int64(existing.ID)
+		if created {
+			id, err = result.LastInsertId()
+			if err != nil {
+				return false, fmt.Errorf("failed to get inserted id: %w", err)
+			}
+		}
+		if _, err := setBirthday(ctx, tx, "id", id, userInfo.BirthDate, userInfo.BirthdaySource); err != nil {
+			return false, err
+		}
+		err = auditEventChange(ctx, tx, int64(merged.IDTG), models.EventBirthday, existing.BirthDate, userInfo.BirthDate, userInfo.BirthdaySource)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return created, nil
+}
+
+func (db *Database) ListSubscribedUsers(ctx context.Context, subscriberID int64) ([]models.ShortUserInfo, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListSubscribedUsers")
+	defer cancel()
+	query, args, err := squirrel.Select(userColumns...).From("users").
+		Where("telegram_id IN (SELECT subscribed_to_id FROM subscriptions WHERE subscriber_id = ?)", subscriberID).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.ShortUserInfo
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return users, nil
+}
+
+func (db *Database) GetCalendarToken(ctx context.Context, telegramID int) (string, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "GetCalendarToken")
+	defer cancel()
+	query, args, err := squirrel.Select("token").From("calendar_tokens").
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var token string
+	err = db.DB.QueryRowContext(ctx, query, args...).Scan(&token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return token, nil
+}
+
+func (db *Database) SaveCalendarToken(ctx context.Context, telegramID int, token string) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SaveCalendarToken")
+	defer cancel()
+	query, args, err := squirrel.Insert("calendar_tokens").
+		Columns("telegram_id", "token").
+		Values(telegramID, token).
+		Suffix("ON CONFLICT(telegram_id) DO UPDATE SET token = excluded.token").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (db *Database) FindUserByCalendarToken(ctx context.Context, token string) (int, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "FindUserByCalendarToken")
+	defer cancel()
+	query, args, err := squirrel.Select("telegram_id").From("calendar_tokens").
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var telegramID int
+	err = db.DB.QueryRowContext(ctx, query, args...).Scan(&telegramID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return telegramID, nil
+}
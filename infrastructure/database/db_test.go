@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"rutube/models"
+)
+
+// TestDeleteUserDropsMessages checks that forgetting a user removes the
+// pending messages addressed to them and the ones that mention them, while
+// unrelated and already sent messages stay.
+func TestDeleteUserDropsMessages(t *testing.T) {
+	db := openTestDatabase(t, Options{MaxOpenConns: 1})
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2, 3} {
+		err := db.InsertUser(ctx, models.ShortUserInfo{IDTG: id, FirstName: "User", BirthDate: "1990-05-10"})
+		if err != nil {
+			t.Fatalf("InsertUser: %v", err)
+		}
+	}
+
+	fund, _, err := db.OpenFund(ctx, 1, 2, "2030-05-10")
+	if err != nil {
+		t.Fatalf("OpenFund: %v", err)
+	}
+
+	messages := []models.OutboxMessage{
+		{ChatID: 1, Text: "to the user", DedupKey: "digest-weekly:1:2030-05-06"},
+		{ChatID: 1, Text: "sent to the user", DedupKey: "sent"},
+		{ChatID: 2, Text: "reminder about the user", DedupKey: "birthday:1:2:2030-05-10:0"},
+		{ChatID: 3, Text: "fund invitation", DedupKey: "fund-open:" + strconv.FormatInt(fund.ID, 10) + ":3"},
+		{ChatID: 2, Text: "fund summary", DedupKey: "fund-summary:" + strconv.FormatInt(fund.ID, 10)},
+		{ChatID: 2, Text: "reminder about another user", DedupKey: "birthday:3:2:2030-05-10:0"},
+		{ChatID: 3, Text: "reminder about user 11", DedupKey: "birthday:11:3:2030-05-10:0"},
+	}
+	if _, err := db.EnqueueMessages(ctx, messages); err != nil {
+		t.Fatalf("EnqueueMessages: %v", err)
+	}
+	if _, err := db.DB.Exec("UPDATE outbox SET status = ? WHERE dedup_key = 'sent'", models.OutboxSent); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteUser(ctx, 1); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	rows, err := db.DB.Query("SELECT dedup_key FROM outbox ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var left []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatal(err)
+		}
+		left = append(left, key)
+	}
+
+	want := []string{"sent", "birthday:3:2:2030-05-10:0", "birthday:11:3:2030-05-10:0"}
+	if len(left) != len(want) {
+		t.Fatalf("outbox after DeleteUser = %v, want %v", left, want)
+	}
+	for i := range want {
+		if left[i] != want[i] {
+			t.Fatalf("outbox after DeleteUser = %v, want %v", left, want)
+		}
+	}
+}
+
+// TestDeleteUserRedactsAudit checks that forgetting a user clears the values
+// of the audit entries about them, while the log otherwise stays append-only.
+func TestDeleteUserRedactsAudit(t *testing.T) {
+	db := openTestDatabase(t, Options{MaxOpenConns: 1})
+	ctx := context.Background()
+
+	for _, id := range []int{1, 2} {
+		err := db.InsertUser(ctx, models.ShortUserInfo{IDTG: id, FirstName: "Name", LastName: "Surname", BirthDate: "1990-05-10"})
+		if err != nil {
+			t.Fatalf("InsertUser: %v", err)
+		}
+	}
+	if err := db.UpdateUserBirthDate(ctx, 1, "1991-06-11", models.BirthdaySourceManual); err != nil {
+		t.Fatalf("UpdateUserBirthDate: %v", err)
+	}
+
+	if err := db.DeleteUser(ctx, 1); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	entries, err := db.ListAudit(ctx, models.AuditFilter{TelegramID: 1})
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(entries) == 0 || entries[0].Action != models.AuditUserDeleted {
+		t.Fatalf("deletion is not logged: %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.OldValue != "" || entry.NewValue != "" {
+			t.Errorf("entry %d about the deleted user keeps values %q -> %q", entry.ID, entry.OldValue, entry.NewValue)
+		}
+	}
+
+	others, err := db.ListAudit(ctx, models.AuditFilter{TelegramID: 2})
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	if len(others) == 0 || others[len(others)-1].NewValue == "" {
+		t.Fatalf("entries about another user were redacted: %+v", others)
+	}
+
+	if _, err := db.DB.Exec("UPDATE audit_log SET action = 'forged' WHERE telegram_id = 2"); err == nil {
+		t.Error("audit entry was modified")
+	}
+	if _, err := db.DB.Exec("UPDATE audit_log SET new_value = 'forged' WHERE telegram_id = 1"); err == nil {
+		t.Error("redacted audit entry was filled in again")
+	}
+	if _, err := db.DB.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("audit entries were deleted")
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"rutube/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var eventColumns = []string{
+	"events.id",
+	"events.user_id",
+	"COALESCE(users.telegram_id, 0)",
+	"events.type",
+	"events.date",
+	"events.recurrence",
+	"events.visibility",
+	"events.source",
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// setBirthday stores the birthday event of the user whose column equals
+// value; a new event gets the user's privacy setting as visibility, an
+// existing one keeps its own. An empty date removes the event. It returns the
+// number of events changed.
+func setBirthday(ctx context.Context, ex execer, column string, value interface{}, date string, source string) (int64, error) {
+	var query string
+	var args []interface{}
+	var err error
+	if date == "" {
+		query, args, err = squirrel.Delete("events").
+			Where(squirrel.Eq{"type": models.EventBirthday}).
+			Where("user_id IN (SELECT id FROM users WHERE "+column+" = ?)", value).
+			ToSql()
+	} else {
+		query, args, err = squirrel.Insert("events").
+			Columns("user_id", "type", "date", "source", "visibility").
+			Select(squirrel.Select("id").
+				Column("?", models.EventBirthday).
+				Column("?", date).
+				Column("?", source).
+				Column("COALESCE((SELECT privacy FROM user_settings WHERE user_settings.telegram_id = users.telegram_id), ?)", models.VisibilityPublic).
+				From("users").
+				Where(squirrel.Eq{column: value})).
+			Suffix("ON CONFLICT(user_id, type) DO UPDATE SET date = excluded.date, source = excluded.source").
+			ToSql()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := ex.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save birthday: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SetEvent creates or replaces the user's event of event.Type.
+func (db *Database) SetEvent(ctx context.Context, event models.Event) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetEvent")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	oldDate, err := eventDate(ctx, tx, int64(event.TelegramID), event.Type)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.Insert("events").
+		Columns("user_id", "type", "date", "recurrence", "visibility", "source").
+		Select(squirrel.Select("id").
+			Column("?", event.Type).
+			Column("?", event.Date).
+			Column("?", event.Recurrence).
+			Column("?", event.Visibility).
+			Column("?", event.Source).
+			From("users").
+			Where(squirrel.Eq{"telegram_id": event.TelegramID})).
+		Suffix(`ON CONFLICT(user_id, type) DO UPDATE SET
+			date = excluded.date, recurrence = excluded.recurrence,
+			visibility = excluded.visibility, source = excluded.source`).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("no user found with telegram_id: %d", event.TelegramID)
+	}
+
+	err = auditEventChange(ctx, tx, int64(event.TelegramID), event.Type, oldDate, event.Date, event.Source)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetEventsVisibility moves the user's events that still have visibility from
+// to visibility to; events given another visibility by hand keep it.
+func (db *Database) SetEventsVisibility(ctx context.Context, telegramID int64, from, to string) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetEventsVisibility")
+	defer cancel()
+	query, args, err := squirrel.Update("events").
+		Set("visibility", to).
+		Where("user_id IN (SELECT id FROM users WHERE telegram_id = ?)", telegramID).
+		Where(squirrel.Eq{"visibility": from}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+func (db *Database) DeleteEvent(ctx context.Context, telegramID int, eventType string) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "DeleteEvent")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	oldDate, err := eventDate(ctx, tx, int64(telegramID), eventType)
+	if err != nil {
+		return false, err
+	}
+
+	query, args, err := squirrel.Delete("events").
+		Where(squirrel.Eq{"type": eventType}).
+		Where("user_id IN (SELECT id FROM users WHERE telegram_id = ?)", telegramID).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	if affected > 0 {
+		if err := auditEventChange(ctx, tx, int64(telegramID), eventType, oldDate, "", ""); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListEvents returns the events of all users, or of one user when telegramID
+// is not zero.
+func (db *Database) ListEvents(ctx context.Context, telegramID int) ([]models.Event, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListEvents")
+	defer cancel()
+	builder := squirrel.Select(eventColumns...).From("events").
+		Join("users ON users.id = events.user_id").
+		OrderBy("events.user_id", "events.id")
+	if telegramID != 0 {
+		builder = builder.Where(squirrel.Eq{"users.telegram_id": telegramID})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return events, nil
+}
+
+func scanEvent(row rowScanner) (models.Event, error) {
+	var event models.Event
+	err := row.Scan(&event.ID, &event.UserID, &event.TelegramID, &event.Type, &event.Date, &event.Recurrence, &event.Visibility, &event.Source)
+	return event, err
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"rutube/models"
+)
+
+// TestSetEventsVisibility checks that a new privacy default moves only the
+// events that still follow the old one.
+func TestSetEventsVisibility(t *testing.T) {
+	db := openTestDatabase(t, Options{MaxOpenConns: 1})
+	ctx := context.Background()
+
+	if err := db.InsertUser(ctx, models.ShortUserInfo{IDTG: 1, FirstName: "User", BirthDate: "1990-05-10"}); err != nil {
+		t.Fatalf("InsertUser: %v", err)
+	}
+	err := db.SetEvent(ctx, models.Event{
+		TelegramID: 1,
+		Type:       models.EventNameDay,
+		Date:       "2000-12-06",
+		Recurrence: models.RecurrenceYearly,
+		Visibility: models.VisibilityPrivate,
+	})
+	if err != nil {
+		t.Fatalf("SetEvent: %v", err)
+	}
+
+	err = db.SetEventsVisibility(ctx, 1, models.VisibilityPublic, models.VisibilitySubscribers)
+	if err != nil {
+		t.Fatalf("SetEventsVisibility: %v", err)
+	}
+
+	events, err := db.ListEvents(ctx, 1)
+	if err != nil {
+		t.Fatalf("ListEvents: %v", err)
+	}
+	want := map[string]string{
+		models.EventBirthday: models.VisibilitySubscribers,
+		models.EventNameDay:  models.VisibilityPrivate,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for _, event := range events {
+		if event.Visibility != want[event.Type] {
+			t.Errorf("%s visibility = %q, want %q", event.Type, event.Visibility, want[event.Type])
+		}
+	}
+}
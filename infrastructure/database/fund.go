@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"rutube/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var fundColumns = []string{"id", "birthday_id", "organiser_id", "date", "closed_at IS NOT NULL"}
+
+// OpenFund starts a collection for the birthday on date. When one is already
+// open, it is returned with created set to false.
+func (db *Database) OpenFund(ctx context.Context, birthdayID, organiserID int64, date string) (fund models.Fund, created bool, err error) {
+
+	ctx, cancel := db.withTimeout(ctx, "OpenFund")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fund, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := squirrel.Insert("funds").Options("OR IGNORE").
+		Columns("birthday_id", "organiser_id", "date").
+		Values(birthdayID, organiserID, date).
+		ToSql()
+	if err != nil {
+		return fund, false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fund, false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fund, false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	query, args, err = squirrel.Select(fundColumns...).From("funds").
+		Where(squirrel.Eq{"birthday_id": birthdayID, "date": date}).
+		ToSql()
+	if err != nil {
+		return fund, false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	fund, err = scanFund(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return models.Fund{}, false, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Fund{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return fund, affected > 0, nil
+}
+
+// GetFund returns a zero Fund when there is no fund with this id.
+func (db *Database) GetFund(ctx context.Context, id int64) (models.Fund, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "GetFund")
+	defer cancel()
+	query, args, err := squirrel.Select(fundColumns...).From("funds").Where(squirrel.Eq{"id": id}).ToSql()
+	if err != nil {
+		return models.Fund{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	fund, err := scanFund(db.DB.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Fund{}, nil
+	}
+	if err != nil {
+		return models.Fund{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return fund, nil
+}
+
+func (db *Database) ListOpenFunds(ctx context.Context) ([]models.Fund, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListOpenFunds")
+	defer cancel()
+	query, args, err := squirrel.Select(fundColumns...).From("funds").
+		Where(squirrel.Eq{"closed_at": nil}).
+		OrderBy("date", "id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var funds []models.Fund
+	for rows.Next() {
+		fund, err := scanFund(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		funds = append(funds, fund)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return funds, nil
+}
+
+func (db *Database) CloseFund(ctx context.Context, id int64) error {
+
+	ctx, cancel := db.withTimeout(ctx, "CloseFund")
+	defer cancel()
+	query, args, err := squirrel.Update("funds").
+		Set("closed_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"id": id, "closed_at": nil}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// SetContribution records or changes a pledge; a changed amount keeps the
+// paid mark.
+func (db *Database) SetContribution(ctx context.Context, fundID, telegramID int64, amount int) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetContribution")
+	defer cancel()
+	query, args, err := squirrel.Insert("fund_contributions").
+		Columns("fund_id", "telegram_id", "amount").
+		Values(fundID, telegramID, amount).
+		Suffix("ON CONFLICT(fund_id, telegram_id) DO UPDATE SET amount = excluded.amount, updated_at = CURRENT_TIMESTAMP").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// MarkContributionPaid reports false when the user has not pledged anything.
+func (db *Database) MarkContributionPaid(ctx context.Context, fundID, telegramID int64) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "MarkContributionPaid")
+	defer cancel()
+	query, args, err := squirrel.Update("fund_contributions").
+		Set("paid", true).
+		Set("updated_at", squirrel.Expr("CURRENT_TIMESTAMP")).
+		Where(squirrel.Eq{"fund_id": fundID, "telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+func (db *Database) ListContributions(ctx context.Context, fundID int64) ([]models.Contribution, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListContributions")
+	defer cancel()
+	query, args, err := squirrel.Select("fund_id", "telegram_id", "amount", "paid").
+		From("fund_contributions").
+		Where(squirrel.Eq{"fund_id": fundID}).
+		OrderBy("updated_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var contributions []models.Contribution
+	for rows.Next() {
+		var contribution models.Contribution
+		err := rows.Scan(&contribution.FundID, &contribution.TelegramID, &contribution.Amount, &contribution.Paid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		contributions = append(contributions, contribution)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return contributions, nil
+}
+
+func scanFund(row rowScanner) (models.Fund, error) {
+	var fund models.Fund
+	err := row.Scan(&fund.ID, &fund.BirthdayID, &fund.OrganiserID, &fund.Date, &fund.Closed)
+	return fund, err
+}
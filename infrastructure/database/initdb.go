@@ -2,26 +2,146 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"net/url"
+	"strings"
+	"time"
 )
 
-func InitDatabase(dbFile string) (*sql.DB, error) {
+type Options struct {
+	MaxOpenConns int
+	BusyTimeout  time.Duration
+}
+
+// sqlitePragmas are applied by go-sqlite3 to every new connection in the pool,
+// which matters for per-connection settings such as foreign_keys.
+var sqlitePragmas = [][2]string{
+	{"_foreign_keys", "on"},
+	{"_journal_mode", "WAL"},
+	{"_synchronous", "NORMAL"},
+	{"_txlock", "immediate"},
+}
 
-	db, err := sql.Open("sqlite3", dbFile)
+// BuildDSN turns a plain file path or an existing DSN into a go-sqlite3 DSN
+// with the pragmas the bot relies on. Parameters already present in the DSN
+// win over the defaults.
+func BuildDSN(dsn string, busyTimeout time.Duration) string {
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		params = url.Values{}
+	}
+
+	for _, pragma := range sqlitePragmas {
+		if params.Get(pragma[0]) == "" {
+			params.Set(pragma[0], pragma[1])
+		}
+	}
+	if params.Get("_busy_timeout") == "" && busyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	}
+
+	return path + "?" + params.Encode()
+}
+
+func InitDatabase(driver string, dsn string, opts Options) (*sql.DB, error) {
+
+	db, err := sql.Open(driver, BuildDSN(dsn, opts.BusyTimeout))
 	if err != nil {
 		return nil, err
 	}
 
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+		db.SetMaxIdleConns(opts.MaxOpenConns)
+	}
+
 	err = db.Ping()
 	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = checkPragmas(db)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	_, err = db.Exec(CreateTableUsers)
 	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	_, err = db.Exec(CreateTableSubscriptions)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = migrate(db)
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	log.Println("Database initialized and table created if not exists")
+	log.Println("Database initialized and tables created if not exist")
 	return db, nil
 }
+
+func checkPragmas(db *sql.DB) error {
+	var foreignKeys int
+	err := db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if err != nil {
+		return fmt.Errorf("failed to read foreign_keys pragma: %w", err)
+	}
+	if foreignKeys != 1 {
+		return fmt.Errorf("foreign keys are not enabled")
+	}
+
+	var journalMode string
+	err = db.QueryRow("PRAGMA journal_mode").Scan(&journalMode)
+	if err != nil {
+		return fmt.Errorf("failed to read journal_mode pragma: %w", err)
+	}
+
+	log.Printf("SQLite journal_mode=%s foreign_keys=on", journalMode)
+	return nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+
+		_, err = tx.Exec(migrations[i])
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+		log.Printf("Applied database migration %d", i+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+
+	"rutube/models"
+)
+
+func openTestDatabase(t *testing.T, opts Options) *Database {
+	t.Helper()
+
+	db, err := InitDatabase("sqlite3", filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewDatabase(zap.NewNop(), db)
+}
+
+func TestBuildDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{
+			dsn:  "Date.db",
+			want: "file:Date.db?_busy_timeout=5000&_foreign_keys=on&_journal_mode=WAL&_synchronous=NORMAL&_txlock=immediate",
+		},
+		{
+			dsn:  "file:Date.db?_journal_mode=DELETE",
+			want: "file:Date.db?_busy_timeout=5000&_foreign_keys=on&_journal_mode=DELETE&_synchronous=NORMAL&_txlock=immediate",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := BuildDSN(tt.dsn, 5*time.Second); got != tt.want {
+			t.Errorf("BuildDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+// TestConcurrentWrites runs parallel writers against a WAL database through a
+// pool of several connections; with immediate transactions and a busy timeout
+// none of them may fail with SQLITE_BUSY.
+func TestConcurrentWrites(t *testing.T) {
+	db := openTestDatabase(t, Options{MaxOpenConns: 8, BusyTimeout: 5 * time.Second})
+	ctx := context.Background()
+
+	var journalMode string
+	if err := db.DB.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatal(err)
+	}
+	if journalMode != "wal" {
+		t.Fatalf("journal_mode = %q, want wal", journalMode)
+	}
+
+	const writers = 8
+	const perWriter = 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter*3)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				id := w*perWriter + i + 1
+				errs <- db.InsertUser(ctx, models.ShortUserInfo{IDTG: id, FirstName: fmt.Sprintf("user %d", id), BirthDate: "1990-01-01"})
+				errs <- db.UpdateUserBirthDate(ctx, id, "1991-02-02", models.BirthdaySourceManual)
+				_, err := db.EnqueueMessages(ctx, []models.OutboxMessage{{ChatID: int64(id), Text: "hello", DedupKey: fmt.Sprint(id)}})
+				errs <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err == nil {
+			continue
+		}
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+			t.Fatalf("concurrent write failed with %v", err)
+		}
+		t.Fatalf("concurrent write failed: %v", err)
+	}
+
+	count, err := db.CountUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != writers*perWriter {
+		t.Fatalf("users = %d, want %d", count, writers*perWriter)
+	}
+}
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// sqliteTimeLayout matches CURRENT_TIMESTAMP so stored times compare as text.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+var outboxColumns = []string{"id", "chat_id", "text", "COALESCE(dedup_key, '')", "status", "attempts", "deferred = 1"}
+
+// EnqueueMessages adds messages to the outbox in one transaction and returns
+// how many were actually queued; messages whose dedup key is already present
+// are skipped.
+func (db *Database) EnqueueMessages(ctx context.Context, messages []models.OutboxMessage) (int, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "EnqueueMessages")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	queued := 0
+	for _, message := range messages {
+		var dedupKey interface{}
+		if message.DedupKey != "" {
+			dedupKey = message.DedupKey
+		}
+
+		query, args, err := squirrel.Insert("outbox").Options("OR IGNORE").
+			Columns("chat_id", "text", "dedup_key").
+			Values(message.ChatID, message.Text, dedupKey).
+			ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("failed to build query: %w", err)
+		}
+
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to enqueue message: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		queued += int(affected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return queued, nil
+}
+
+func (db *Database) DueMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "DueMessages")
+	defer cancel()
+	return db.queryOutbox(ctx, squirrel.Select(outboxColumns...).
+		From("outbox").
+		Where(squirrel.Eq{"status": models.OutboxPending}).
+		Where(squirrel.LtOrEq{"next_attempt_at": sqliteTime(now)}).
+		OrderBy("next_attempt_at", "id").
+		Limit(uint64(limit)))
+}
+
+// DeferredMessages returns the due messages of a chat that were held back by
+// quiet hours or a vacation, oldest first.
+func (db *Database) DeferredMessages(ctx context.Context, chatID int64, now time.Time) ([]models.OutboxMessage, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "DeferredMessages")
+	defer cancel()
+	return db.queryOutbox(ctx, squirrel.Select(outboxColumns...).
+		From("outbox").
+		Where(squirrel.Eq{"status": models.OutboxPending, "chat_id": chatID, "deferred": 1}).
+		Where(squirrel.LtOrEq{"next_attempt_at": sqliteTime(now)}).
+		OrderBy("created_at", "id"))
+}
+
+func (db *Database) queryOutbox(ctx context.Context, builder squirrel.SelectBuilder) ([]models.OutboxMessage, error) {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		err := rows.Scan(&message.ID, &message.ChatID, &message.Text, &message.DedupKey, &message.Status, &message.Attempts, &message.Deferred)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return messages, nil
+}
+
+func (db *Database) MarkMessageSent(ctx context.Context, id int64) error {
+	return db.updateOutbox(ctx, id, squirrel.Eq{
+		"status":     models.OutboxSent,
+		"attempts":   squirrel.Expr("attempts + 1"),
+		"last_error": "",
+		"sent_at":    squirrel.Expr("CURRENT_TIMESTAMP"),
+	})
+}
+
+// RetryMessage counts a failed attempt and schedules the next one.
+func (db *Database) RetryMessage(ctx context.Context, id int64, next time.Time, lastError string) error {
+	return db.updateOutbox(ctx, id, squirrel.Eq{
+		"attempts":        squirrel.Expr("attempts + 1"),
+		"last_error":      lastError,
+		"next_attempt_at": sqliteTime(next),
+	})
+}
+
+// PostponeMessage moves the next attempt without counting it as a failure,
+// e.g. when Telegram asks to slow down.
+func (db *Database) PostponeMessage(ctx context.Context, id int64, next time.Time) error {
+	return db.updateOutbox(ctx, id, squirrel.Eq{
+		"next_attempt_at": sqliteTime(next),
+	})
+}
+
+// DeferMessage holds a message back until the recipient's quiet hours or
+// vacation end; it is then delivered as part of a catch-up message.
+func (db *Database) DeferMessage(ctx context.Context, id int64, until time.Time) error {
+	return db.updateOutbox(ctx, id, squirrel.Eq{
+		"deferred":        1,
+		"next_attempt_at": sqliteTime(until),
+	})
+}
+
+// FailMessage stops delivery of a message; status is either OutboxFailed or
+// OutboxUndeliverable.
+func (db *Database) FailMessage(ctx context.Context, id int64, status string, lastError string) error {
+	return db.updateOutbox(ctx, id, squirrel.Eq{
+		"status":     status,
+		"attempts":   squirrel.Expr("attempts + 1"),
+		"last_error": lastError,
+	})
+}
+
+func (db *Database) updateOutbox(ctx context.Context, id int64, values map[string]interface{}) error {
+
+	ctx, cancel := db.withTimeout(ctx, "updateOutbox")
+	defer cancel()
+	query, args, err := squirrel.Update("outbox").SetMap(values).Where(squirrel.Eq{"id": id}).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update outbox message %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// PruneOutbox deletes finished messages created before the given time.
+// Pending messages are never removed.
+func (db *Database) PruneOutbox(ctx context.Context, before time.Time) (int64, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "PruneOutbox")
+	defer cancel()
+	query, args, err := squirrel.Delete("outbox").
+		Where(squirrel.NotEq{"status": models.OutboxPending}).
+		Where(squirrel.Lt{"created_at": sqliteTime(before)}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune outbox: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// deleteUserMessages drops the pending messages to a user and those about
+// them: reminders carry the person's telegram_id in the dedup key, fund
+// messages the id of a fund for their birthday. It runs before the user row
+// is deleted, while the funds still exist.
+func deleteUserMessages(ctx context.Context, tx execer, telegramID int64) error {
+	mentions := squirrel.Or{
+		squirrel.Eq{"chat_id": telegramID},
+		squirrel.Expr(`EXISTS (SELECT 1 FROM funds WHERE funds.birthday_id = ?
+			AND (outbox.dedup_key = 'fund-summary:' || funds.id OR outbox.dedup_key LIKE 'fund-open:' || funds.id || ':%'))`, telegramID),
+	}
+	for _, eventType := range models.EventTypes {
+		mentions = append(mentions, squirrel.Like{"dedup_key": fmt.Sprintf("%s:%d:%%", eventType, telegramID)})
+	}
+
+	query, args, err := squirrel.Delete("outbox").
+		Where(squirrel.Eq{"status": models.OutboxPending}).
+		Where(mentions).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete outbox messages: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"rutube/models"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// SetPendingBirthday stores a detected date for confirmation, replacing any
+// earlier one and restarting its expiry.
+func (db *Database) SetPendingBirthday(ctx context.Context, pending models.PendingBirthday) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SetPendingBirthday")
+	defer cancel()
+	query, args, err := squirrel.Insert("pending_birthdays").Options("OR REPLACE").
+		Columns("telegram_id", "birth_date", "source").
+		Values(pending.TelegramID, pending.BirthDate, pending.Source).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// TakePendingBirthday removes the user's pending birthDate and returns it
+// unless it was created before notBefore. ok is false when no such date was
+// pending or it has expired.
+func (db *Database) TakePendingBirthday(ctx context.Context, telegramID int, birthDate string, notBefore time.Time) (pending models.PendingBirthday, ok bool, err error) {
+
+	ctx, cancel := db.withTimeout(ctx, "TakePendingBirthday")
+	defer cancel()
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return pending, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := squirrel.Select("telegram_id", "birth_date", "source").
+		Column(squirrel.Expr("created_at >= ?", sqliteTime(notBefore))).
+		From("pending_birthdays").
+		Where(squirrel.Eq{"telegram_id": telegramID, "birth_date": birthDate}).
+		ToSql()
+	if err != nil {
+		return pending, false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&pending.TelegramID, &pending.BirthDate, &pending.Source, &ok)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.PendingBirthday{}, false, nil
+	}
+	if err != nil {
+		return models.PendingBirthday{}, false, fmt.Errorf("failed to scan row: %w", err)
+	}
+
+	query, args, err = squirrel.Delete("pending_birthdays").Where(squirrel.Eq{"telegram_id": telegramID, "birth_date": birthDate}).ToSql()
+	if err != nil {
+		return models.PendingBirthday{}, false, fmt.Errorf("failed to build query: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return models.PendingBirthday{}, false, fmt.Errorf("failed to delete pending birthday: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.PendingBirthday{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if !ok {
+		return models.PendingBirthday{}, false, nil
+	}
+	return pending, true, nil
+}
+
+func (db *Database) DeletePendingBirthday(ctx context.Context, telegramID int) error {
+
+	ctx, cancel := db.withTimeout(ctx, "DeletePendingBirthday")
+	defer cancel()
+	query, args, err := squirrel.Delete("pending_birthdays").Where(squirrel.Eq{"telegram_id": telegramID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// ExpirePendingBirthdays deletes dates that were not confirmed since before.
+func (db *Database) ExpirePendingBirthdays(ctx context.Context, before time.Time) (int64, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ExpirePendingBirthdays")
+	defer cancel()
+	query, args, err := squirrel.Delete("pending_birthdays").
+		Where(squirrel.Lt{"created_at": sqliteTime(before)}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending birthdays: %w", err)
+	}
+
+	return result.RowsAffected()
+}
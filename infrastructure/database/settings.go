@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"rutube/models"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var settingsColumns = []string{
+	"telegram_id",
+	"language",
+	"time_zone",
+	"notify_hour",
+	"reminder_offsets",
+	"digest_weekly = 1",
+	"digest_monthly = 1",
+	"privacy",
+	"quiet_from",
+	"quiet_to",
+	"vacation_from",
+	"vacation_to",
+}
+
+// GetSettings returns DefaultSettings for a user who never changed them.
+func (db *Database) GetSettings(ctx context.Context, telegramID int64) (models.Settings, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "GetSettings")
+	defer cancel()
+	query, args, err := squirrel.Select(settingsColumns...).From("user_settings").
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return models.Settings{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	settings, err := scanSettings(db.DB.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultSettings(telegramID), nil
+	}
+	if err != nil {
+		return models.Settings{}, fmt.Errorf("failed to scan row: %w", err)
+	}
+	return settings, nil
+}
+
+func (db *Database) SaveSettings(ctx context.Context, settings models.Settings) error {
+
+	ctx, cancel := db.withTimeout(ctx, "SaveSettings")
+	defer cancel()
+	query, args, err := insertSettings(settings).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// ListSettings returns only users who changed their settings.
+func (db *Database) ListSettings(ctx context.Context) ([]models.Settings, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListSettings")
+	defer cancel()
+	query, args, err := squirrel.Select(settingsColumns...).From("user_settings").
+		OrderBy("telegram_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Settings
+	for rows.Next() {
+		settings, err := scanSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, settings)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return result, nil
+}
+
+func insertSettings(settings models.Settings) squirrel.InsertBuilder {
+	return squirrel.Insert("user_settings").Options("OR REPLACE").
+		Columns("telegram_id", "language", "time_zone", "notify_hour", "reminder_offsets",
+			"digest_weekly", "digest_monthly", "privacy", "quiet_from", "quiet_to", "vacation_from", "vacation_to").
+		Values(settings.TelegramID, settings.Language, settings.TimeZone, settings.NotifyHour, formatOffsets(settings.ReminderOffsets),
+			settings.DigestWeekly, settings.DigestMonthly, settings.Privacy, settings.QuietFrom, settings.QuietTo,
+			settings.VacationFrom, settings.VacationTo)
+}
+
+func scanSettings(row rowScanner) (models.Settings, error) {
+	var settings models.Settings
+	var offsets sql.NullString
+	err := row.Scan(&settings.TelegramID, &settings.Language, &settings.TimeZone, &settings.NotifyHour, &offsets,
+		&settings.DigestWeekly, &settings.DigestMonthly, &settings.Privacy, &settings.QuietFrom, &settings.QuietTo,
+		&settings.VacationFrom, &settings.VacationTo)
+	if err != nil {
+		return settings, err
+	}
+	settings.ReminderOffsets, err = parseOffsets(offsets)
+	return settings, err
+}
+
+// formatOffsets keeps nil and empty offsets apart: NULL and ”.
+func formatOffsets(offsets []int) interface{} {
+	if offsets == nil {
+		return nil
+	}
+	parts := make([]string, len(offsets))
+	for i, offset := range offsets {
+		parts[i] = strconv.Itoa(offset)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseOffsets(value sql.NullString) ([]int, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	offsets := []int{}
+	for _, part := range strings.Split(value.String, ",") {
+		if part == "" {
+			continue
+		}
+		offset, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder offset %q: %w", part, err)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var wishlistColumns = []string{"id", "telegram_id", "text", "url"}
+
+func (db *Database) AddWishlistItem(ctx context.Context, item models.WishlistItem) error {
+
+	ctx, cancel := db.withTimeout(ctx, "AddWishlistItem")
+	defer cancel()
+	query, args, err := squirrel.Insert("wishlist").
+		Columns("telegram_id", "text", "url").
+		Values(item.TelegramID, item.Text, item.URL).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveWishlistItem deletes an item of the given user and reports whether
+// there was one.
+func (db *Database) RemoveWishlistItem(ctx context.Context, telegramID int64, id int64) (bool, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "RemoveWishlistItem")
+	defer cancel()
+	query, args, err := squirrel.Delete("wishlist").
+		Where(squirrel.Eq{"id": id, "telegram_id": telegramID}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	result, err := db.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute query: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// ListWishlist returns the user's items in the order they were added.
+func (db *Database) ListWishlist(ctx context.Context, telegramID int64) ([]models.WishlistItem, error) {
+
+	ctx, cancel := db.withTimeout(ctx, "ListWishlist")
+	defer cancel()
+	query, args, err := squirrel.Select(wishlistColumns...).From("wishlist").
+		Where(squirrel.Eq{"telegram_id": telegramID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	var items []models.WishlistItem
+	for rows.Next() {
+		var item models.WishlistItem
+		err := rows.Scan(&item.ID, &item.TelegramID, &item.Text, &item.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return items, nil
+}
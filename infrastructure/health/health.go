@@ -0,0 +1,71 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const checkTimeout = 3 * time.Second
+
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Checker runs the readiness checks registered by the components the bot
+// depends on.
+type Checker struct {
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		checks: make(map[string]Check),
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Run executes all checks concurrently, each bounded by checkTimeout.
+func (c *Checker) Run(ctx context.Context) Result {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	errs := make([]error, len(c.names))
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			errs[i] = check(ctx)
+		}(i, c.checks[name])
+	}
+	wg.Wait()
+
+	result := Result{Ready: true, Checks: make(map[string]string, len(c.names))}
+	for i, name := range c.names {
+		if errs[i] != nil {
+			result.Ready = false
+			result.Checks[name] = errs[i].Error()
+			continue
+		}
+		result.Checks[name] = "ok"
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const namespace = "birthday_bot"
+
+var (
+	UpdatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_total",
+		Help:      "Telegram updates received, by command.",
+	}, []string{"command"})
+
+	HandlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_errors_total",
+		Help:      "Errors returned to update handlers, by handler.",
+	}, []string{"handler"})
+
+	TelegramRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_requests_total",
+		Help:      "Telegram Bot API calls, by method.",
+	}, []string{"method"})
+
+	TelegramFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_failures_total",
+		Help:      "Failed Telegram Bot API calls, by method.",
+	}, []string{"method"})
+
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Duration of repository operations, by operation.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+	}, []string{"operation"})
+
+	SchedulerRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scheduler_runs_total",
+		Help:      "Scheduled job runs, by job and result.",
+	}, []string{"job", "result"})
+
+	NotificationsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Outbox messages processed, by final status.",
+	}, []string{"status"})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Result turns an error into a low-cardinality label value.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// StatsSource provides the counts exported as gauges. They are read from the
+// database on every scrape, so they are always exact.
+type StatsSource interface {
+	CountUsers(ctx context.Context) (int, error)
+	CountSubscriptions(ctx context.Context) (int, error)
+}
+
+type statsCollector struct {
+	logger        *zap.Logger
+	source        StatsSource
+	users         *prometheus.Desc
+	subscriptions *prometheus.Desc
+}
+
+func RegisterStats(logger *zap.Logger, source StatsSource) {
+	prometheus.MustRegister(&statsCollector{
+		logger: logger,
+		source: source,
+		users: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "registered_users"),
+			"Users stored in the database.", nil, nil),
+		subscriptions: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "subscriptions"),
+			"Birthday subscriptions stored in the database.", nil, nil),
+	})
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.users
+	ch <- c.subscriptions
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if users, err := c.source.CountUsers(ctx); err != nil {
+		c.logger.Error("Failed to count users for metrics", zap.Error(err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.users, prometheus.GaugeValue, float64(users))
+	}
+
+	if subscriptions, err := c.source.CountSubscriptions(ctx); err != nil {
+		c.logger.Error("Failed to count subscriptions for metrics", zap.Error(err))
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.subscriptions, prometheus.GaugeValue, float64(subscriptions))
+	}
+}
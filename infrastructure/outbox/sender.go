@@ -0,0 +1,304 @@
+package outbox
+
+import (
+	"context"
+	telegramconnect "rutube/infrastructure/TelegramConnect"
+	"rutube/infrastructure/database"
+	"rutube/infrastructure/metrics"
+	"rutube/models"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const (
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+	// maxMessageLength is Telegram's limit on the length of a text message.
+	maxMessageLength = 4096
+)
+
+type Options struct {
+	// Rate is the number of messages per second sent across all chats.
+	Rate int
+	// ChatInterval is the minimum gap between two messages to the same chat.
+	ChatInterval time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	// Location is the time zone for the quiet hours of users who have not
+	// chosen one, the same as the reminder scheduler's; nil means the
+	// server's zone.
+	Location *time.Location
+}
+
+// Sender delivers messages queued in the outbox table. Delivery is
+// at-least-once: a message is marked sent only after Telegram accepted it.
+// Everything the bot sends on its own goes through the outbox and so honours
+// quiet hours and vacations; replies to a user's own command, including the
+// fund summary for the organiser who closes a fund, are sent directly.
+type Sender struct {
+	Logger  *zap.Logger
+	db      *database.Database
+	tg      *telegramconnect.TelegramClient
+	opts    Options
+	limiter *rate.Limiter
+
+	lastSent    map[int64]time.Time
+	pausedUntil time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewSender(logger *zap.Logger, db *database.Database, tg *telegramconnect.TelegramClient, opts Options) *Sender {
+	return &Sender{
+		Logger:   logger,
+		db:       db,
+		tg:       tg,
+		opts:     opts,
+		limiter:  rate.NewLimiter(rate.Limit(opts.Rate), 1),
+		lastSent: make(map[int64]time.Time),
+	}
+}
+
+func (s *Sender) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.loop(ctx)
+	s.Logger.Info("Outbox sender started")
+}
+
+func (s *Sender) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.Logger.Info("Outbox sender stopped")
+}
+
+// Prune removes delivered and failed messages older than retention.
+func (s *Sender) Prune(ctx context.Context, retention time.Duration) error {
+	deleted, err := s.db.PruneOutbox(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	s.Logger.Info("Outbox pruned", zap.Int64("deleted", deleted))
+	return nil
+}
+
+func (s *Sender) loop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.drain(ctx)
+		}
+	}
+}
+
+func (s *Sender) drain(ctx context.Context) {
+	for time.Now().After(s.pausedUntil) {
+		messages, err := s.db.DueMessages(ctx, time.Now(), s.opts.BatchSize)
+		if err != nil {
+			s.Logger.Error("Failed to read outbox", zap.Error(err))
+			return
+		}
+
+		handled := make(map[int64]bool)
+		for _, message := range messages {
+			if ctx.Err() != nil || time.Now().Before(s.pausedUntil) {
+				return
+			}
+			if handled[message.ID] {
+				continue
+			}
+			for _, id := range s.deliver(ctx, message) {
+				handled[id] = true
+			}
+		}
+
+		// Rows that could not be updated are still due; reading them again
+		// right away would spin, so they wait for the next tick.
+		if len(messages) < s.opts.BatchSize || len(handled) == 0 {
+			break
+		}
+	}
+
+	for chatID, sent := range s.lastSent {
+		if time.Since(sent) > s.opts.ChatInterval {
+			delete(s.lastSent, chatID)
+		}
+	}
+}
+
+// deliver sends a message, or a catch-up of all deferred messages of the chat,
+// and returns the IDs of the messages it updated in the outbox. An empty
+// result means nothing could be written and the message is still due.
+func (s *Sender) deliver(ctx context.Context, message models.OutboxMessage) []int64 {
+	logger := s.Logger.With(zap.Int64("message_id", message.ID), zap.Int64("chat_id", message.ChatID))
+
+	// A failure to prepare the message counts as a delivery attempt, so the
+	// message backs off instead of coming back on every read of the outbox.
+	retry := func(msg string, err error) []int64 {
+		logger.Error(msg, zap.Error(err))
+		if err := s.record(ctx, message, err); err != nil {
+			logger.Error("Failed to update outbox message", zap.Error(err))
+			return nil
+		}
+		return []int64{message.ID}
+	}
+
+	if sent, ok := s.lastSent[message.ChatID]; ok && time.Since(sent) < s.opts.ChatInterval {
+		if err := s.db.PostponeMessage(ctx, message.ID, sent.Add(s.opts.ChatInterval)); err != nil {
+			return retry("Failed to postpone message", err)
+		}
+		return []int64{message.ID}
+	}
+
+	settings, err := s.db.GetSettings(ctx, message.ChatID)
+	if err != nil {
+		return retry("Failed to read recipient settings", err)
+	}
+	if until, quiet := settings.QuietUntil(time.Now().In(settings.Location(s.location()))); quiet {
+		if err := s.db.DeferMessage(ctx, message.ID, until); err != nil {
+			return retry("Failed to defer message", err)
+		}
+		return []int64{message.ID}
+	}
+
+	batch := []models.OutboxMessage{message}
+	text := message.Text
+	if message.Deferred {
+		batch, text, err = s.catchUp(ctx, message, settings.Language)
+		if err != nil {
+			return retry("Failed to read deferred messages", err)
+		}
+	}
+
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil
+	}
+
+	err = s.tg.Response(ctx, message.ChatID, text)
+	s.lastSent[message.ChatID] = time.Now()
+
+	// Cancelled by shutdown: the message stays pending and is retried on the
+	// next start without counting the attempt.
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(batch))
+	wait, flood := telegramconnect.RetryAfter(err)
+	if flood {
+		s.pausedUntil = time.Now().Add(wait)
+		logger.Warn("Telegram flood limit hit, pausing sender", zap.Duration("retry_after", wait))
+	}
+	for _, m := range batch {
+		var updateErr error
+		if flood {
+			updateErr = s.db.PostponeMessage(ctx, m.ID, s.pausedUntil)
+		} else {
+			updateErr = s.record(ctx, m, err)
+		}
+		if updateErr != nil {
+			logger.Error("Failed to update outbox message", zap.Int64("batched_id", m.ID), zap.Error(updateErr))
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func (s *Sender) location() *time.Location {
+	if s.opts.Location != nil {
+		return s.opts.Location
+	}
+	return time.Local
+}
+
+// catchUp joins the deferred messages of a chat into one text, as many as fit
+// into a Telegram message; the rest follow in the next catch-up.
+func (s *Sender) catchUp(ctx context.Context, message models.OutboxMessage, lang string) ([]models.OutboxMessage, string, error) {
+	deferred, err := s.db.DeferredMessages(ctx, message.ChatID, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	if len(deferred) <= 1 {
+		return []models.OutboxMessage{message}, message.Text, nil
+	}
+
+	text := "📬 Пока вы были недоступны:"
+	if lang == models.LanguageEnglish {
+		text = "📬 While you were away:"
+	}
+	var batch []models.OutboxMessage
+	for _, m := range deferred {
+		next := text + "\n\n" + m.Text
+		if len(batch) > 0 && utf8.RuneCountInString(next) > maxMessageLength {
+			break
+		}
+		text = next
+		batch = append(batch, m)
+	}
+	if len(batch) == 1 {
+		return batch, batch[0].Text, nil
+	}
+	return batch, text, nil
+}
+
+func (s *Sender) record(ctx context.Context, message models.OutboxMessage, sendErr error) error {
+	switch {
+	case sendErr == nil:
+		metrics.NotificationsSent.WithLabelValues(models.OutboxSent).Inc()
+		return s.db.MarkMessageSent(ctx, message.ID)
+	case telegramconnect.IsPermanent(sendErr):
+		metrics.NotificationsSent.WithLabelValues(models.OutboxUndeliverable).Inc()
+		s.Logger.Warn("Message is undeliverable", zap.Int64("chat_id", message.ChatID), zap.Error(sendErr))
+		if telegramconnect.IsBlocked(sendErr) {
+			s.deactivate(ctx, message.ChatID)
+		}
+		return s.db.FailMessage(ctx, message.ID, models.OutboxUndeliverable, sendErr.Error())
+	case message.Attempts+1 >= s.opts.MaxAttempts:
+		metrics.NotificationsSent.WithLabelValues(models.OutboxFailed).Inc()
+		s.Logger.Error("Giving up on message", zap.Int64("chat_id", message.ChatID), zap.Error(sendErr))
+		return s.db.FailMessage(ctx, message.ID, models.OutboxFailed, sendErr.Error())
+	default:
+		return s.db.RetryMessage(ctx, message.ID, time.Now().Add(backoff(message.Attempts)), sendErr.Error())
+	}
+}
+
+func (s *Sender) deactivate(ctx context.Context, chatID int64) {
+	changed, err := s.db.SetUserActive(ctx, int(chatID), false)
+	if err != nil {
+		s.Logger.Error("Failed to deactivate user", zap.Int64("chat_id", chatID), zap.Error(err))
+		return
+	}
+	if changed {
+		s.Logger.Info("User blocked the bot, deactivated", zap.Int64("chat_id", chatID))
+	}
+}
+
+// backoff doubles the delay after every failed attempt.
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 0; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -1,28 +1,72 @@
 package router
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"rutube/controller"
+	"rutube/infrastructure/audit"
+	"rutube/infrastructure/logging"
+	"rutube/infrastructure/metrics"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
+// maxWebhookBodySize is far above any real Telegram update; documents are
+// sent as file ids, not inline.
+const maxWebhookBodySize = 1 << 20
+
 type GoChiRouter struct {
 	Logger  *zap.Logger
 	Router  chi.Router
 	Handler controller.HandlersInterface
 }
 
-func NewGoChiRouting(logger *zap.Logger, handler controller.HandlersInterface) *GoChiRouter {
+func NewGoChiRouting(logger *zap.Logger, handler controller.HandlersInterface, api controller.APIHandlersInterface, healthHandler controller.HealthHandlersInterface, apiToken string) *GoChiRouter {
 
 	router := chi.NewRouter()
-	router.Use(loggingMiddleware(logger))
-	router.Post("/telegram-webhook", handler.CommandHandler)
+	router.Use(requestIDMiddleware(logger))
+	router.Use(accessLogMiddleware(logger))
+	router.Use(recoveryMiddleware(logger))
+	router.With(bodyLimitMiddleware(maxWebhookBodySize)).Post("/telegram-webhook", handler.CommandHandler)
+	router.Get("/calendar/{token}.ics", handler.CalendarFeed)
+	router.Handle("/metrics", metrics.Handler())
+	router.Get("/healthz", healthHandler.Healthz)
+	router.Get("/readyz", healthHandler.Readyz)
+
+	router.Route("/api/v1", func(r chi.Router) {
+		r.Get("/openapi.yaml", api.OpenAPISpec)
+
+		if apiToken == "" {
+			logger.Warn("ADMIN_API_TOKEN is not set, admin API is disabled")
+			return
+		}
+
+		r.Group(func(r chi.Router) {
+			r.Use(tokenAuthMiddleware(logger, apiToken))
+
+			r.Get("/users", api.ListUsers)
+			r.Post("/users", api.CreateUser)
+			r.Get("/users/{telegramID}", api.GetUser)
+			r.Get("/users/by-username/{username}", api.GetUserByUsername)
+			r.Put("/users/{telegramID}", api.UpdateUser)
+			r.Delete("/users/{telegramID}", api.DeleteUser)
+
+			r.Get("/subscriptions", api.ListSubscriptions)
+			r.Post("/subscriptions", api.CreateSubscription)
+			r.Delete("/subscriptions/{subscriberID}/{subscribedToID}", api.DeleteSubscription)
+
+			r.Get("/birthdays/upcoming", api.UpcomingBirthdays)
+
+			r.Get("/audit", api.AuditLog)
+		})
+	})
 
 	return &GoChiRouter{
-		Logger: logger,
-		Router: router,
+		Logger:  logger,
+		Router:  router,
+		Handler: handler,
 	}
 }
 
@@ -30,11 +74,18 @@ func (gc *GoChiRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	gc.Router.ServeHTTP(w, r)
 }
 
-func loggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+func tokenAuthMiddleware(logger *zap.Logger, token string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logger.Info("Incoming request", zap.String("method", r.Method), zap.String("url", r.URL.String()))
-			next.ServeHTTP(w, r)
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				logging.FromContext(r.Context(), logger).Warn("Unauthorized API request", zap.String("path", r.URL.Path), zap.String("remote", r.RemoteAddr))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"message":"unauthorized","success":false}`))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(audit.WithActor(r.Context(), audit.ActorAPI)))
 		})
 	}
 }
@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"rutube/infrastructure/metrics"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// heartbeatSlack covers the duration of the job run itself.
+const heartbeatSlack = time.Minute
+
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+type Scheduler struct {
+	Logger  *zap.Logger
+	jobs    []Job
+	mu      sync.RWMutex
+	lastRun map[string]time.Time
+	started time.Time
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewScheduler(logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		Logger:  logger,
+		lastRun: make(map[string]time.Time),
+	}
+}
+
+func (s *Scheduler) Add(name string, interval time.Duration, run func(ctx context.Context) error) {
+	s.jobs = append(s.jobs, Job{Name: name, Interval: interval, Run: run})
+}
+
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.started = time.Now()
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+	s.Logger.Info("Scheduler started", zap.Int("jobs", len(s.jobs)))
+}
+
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	s.wg.Wait()
+	s.Logger.Info("Scheduler stopped")
+}
+
+// LastRun returns the time the job last finished, successfully or not.
+func (s *Scheduler) LastRun(name string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastRun[name]
+}
+
+// Heartbeat fails when a job has missed two of its runs in a row, which means
+// its goroutine is stuck or gone.
+func (s *Scheduler) Heartbeat(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.started.IsZero() {
+		return fmt.Errorf("scheduler is not running")
+	}
+
+	for _, job := range s.jobs {
+		last := s.lastRun[job.Name]
+		if last.IsZero() {
+			last = s.started
+		}
+		if since := time.Since(last); since > 2*job.Interval+heartbeatSlack {
+			return fmt.Errorf("job %s has not run for %s", job.Name, since.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.run(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	start := time.Now()
+	err := job.Run(ctx)
+	metrics.SchedulerRuns.WithLabelValues(job.Name, metrics.Result(err)).Inc()
+	if err != nil {
+		s.Logger.Error("Scheduled job failed", zap.String("job", job.Name), zap.Error(err))
+	} else {
+		s.Logger.Info("Scheduled job finished", zap.String("job", job.Name), zap.Duration("duration", time.Since(start)))
+	}
+
+	s.mu.Lock()
+	s.lastRun[job.Name] = time.Now()
+	s.mu.Unlock()
+}
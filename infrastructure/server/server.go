@@ -2,70 +2,256 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+type Options struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TLS is enabled either with CertFile and KeyFile, which are re-read by
+	// ReloadCertificate, or with SelfSigned, which generates a certificate for
+	// Hosts once per process.
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+	Hosts      []string
+
+	// DrainDelay is how long Stop keeps serving with readiness failing before
+	// it closes the listener, giving the load balancer time to notice.
+	DrainDelay time.Duration
+}
+
 type ServerHTTP struct {
-	server *http.Server
-	Logger *zap.Logger
+	Logger   *zap.Logger
+	handler  http.Handler
+	addr     string
+	opts     Options
+	draining atomic.Bool
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+	certs    *certificateStore
+	// cancel aborts the base context of every request once Shutdown has
+	// waited long enough, so handlers stuck in DB or Telegram calls return.
+	cancel context.CancelFunc
 }
 
-func NewServerHTTP(logger *zap.Logger, handler http.Handler, adr string) *ServerHTTP {
-	return &ServerHTTP{
+func NewServerHTTP(logger *zap.Logger, handler http.Handler, adr string, opts Options) *ServerHTTP {
+	sh := &ServerHTTP{
+		Logger:  logger,
+		handler: handler,
+		addr:    adr,
+		opts:    opts,
+	}
+	sh.server = sh.newServer()
+	return sh
+}
 
-		server: &http.Server{
-			Addr:    adr,
-			Handler: handler,
-		},
+func (sh *ServerHTTP) newServer() *http.Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	sh.cancel = cancel
 
-		Logger: logger,
+	return &http.Server{
+		Addr:              sh.addr,
+		Handler:           sh.handler,
+		ReadTimeout:       sh.opts.ReadTimeout,
+		ReadHeaderTimeout: sh.opts.ReadHeaderTimeout,
+		WriteTimeout:      sh.opts.WriteTimeout,
+		IdleTimeout:       sh.opts.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
 	}
 }
 
+// Start listens on the configured address and serves until Stop is called,
+// in which case it returns nil.
 func (sh *ServerHTTP) Start() error {
-	sh.Logger.Info("Starting HTTP Server")
-
-	err := http.ListenAndServe(sh.server.Addr, sh.server.Handler)
+	srv, ln, err := sh.listen()
 	if err != nil {
 		sh.Logger.Error("Error starting HTTP server", zap.Error(err))
 		return err
 	}
 
-	sh.Logger.Info("The server has been started successfully.")
+	return sh.serve(srv, ln)
+}
+
+func (sh *ServerHTTP) listen() (*http.Server, net.Listener, error) {
+	tlsConfig, err := sh.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.listener != nil {
+		return nil, nil, errors.New("server is already running")
+	}
+
+	ln, err := net.Listen("tcp", sh.addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", sh.addr, err)
+	}
+
+	sh.server.TLSConfig = tlsConfig
+	sh.listener = ln
+	return sh.server, ln, nil
+}
+
+func (sh *ServerHTTP) serve(srv *http.Server, ln net.Listener) error {
+	sh.Logger.Info("HTTP server listening", zap.String("address", ln.Addr().String()), zap.Bool("tls", srv.TLSConfig != nil))
+
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	sh.Logger.Error("HTTP server stopped unexpectedly", zap.Error(err))
+	return err
+}
+
+func (sh *ServerHTTP) tlsConfig() (*tls.Config, error) {
+	certs, err := sh.certificates()
+	if err != nil || certs == nil {
+		return nil, err
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}, nil
+}
+
+// certificates loads the TLS certificate once and keeps it across restarts;
+// it returns nil when TLS is disabled.
+func (sh *ServerHTTP) certificates() (*certificateStore, error) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.certs != nil {
+		return sh.certs, nil
+	}
+
+	var err error
+	switch {
+	case sh.opts.SelfSigned:
+		sh.certs, err = newSelfSignedCertificateStore(sh.opts.Hosts)
+		if err == nil {
+			sh.Logger.Warn("Serving HTTPS with a self-signed certificate", zap.Strings("hosts", sh.opts.Hosts))
+		}
+	case sh.opts.CertFile != "":
+		sh.certs, err = newFileCertificateStore(sh.opts.CertFile, sh.opts.KeyFile)
+	}
+	return sh.certs, err
+}
+
+// Certificate returns the PEM encoded certificate the server presents, or nil
+// when TLS is disabled. It is uploaded to Telegram for self-signed setups.
+func (sh *ServerHTTP) Certificate() ([]byte, error) {
+	certs, err := sh.certificates()
+	if err != nil || certs == nil {
+		return nil, err
+	}
+	return certs.PEM(), nil
+}
+
+// ReloadCertificate re-reads the certificate files; new handshakes use the
+// new certificate while open connections are kept.
+func (sh *ServerHTTP) ReloadCertificate() error {
+	certs, err := sh.certificates()
+	if err != nil || certs == nil {
+		return err
+	}
+
+	if err := certs.Reload(); err != nil {
+		sh.Logger.Error("Failed to reload TLS certificate", zap.Error(err))
+		return err
+	}
+	sh.Logger.Info("TLS certificate reloaded")
+	return nil
+}
+
+// Addr returns the address the server actually listens on, which differs from
+// the configured one when the port is 0.
+func (sh *ServerHTTP) Addr() string {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.listener == nil {
+		return sh.addr
+	}
+	return sh.listener.Addr().String()
+}
+
+// Ready fails as soon as shutdown has begun.
+func (sh *ServerHTTP) Ready(ctx context.Context) error {
+	if sh.draining.Load() {
+		return errors.New("server is shutting down")
+	}
 	return nil
 }
 
 func (sh *ServerHTTP) Stop(ctx context.Context) error {
+	sh.draining.Store(true)
+	if sh.opts.DrainDelay > 0 {
+		sh.Logger.Info("Draining before shutdown", zap.Duration("delay", sh.opts.DrainDelay))
+		select {
+		case <-time.After(sh.opts.DrainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	sh.mu.Lock()
+	srv, cancel := sh.server, sh.cancel
+	sh.mu.Unlock()
+
 	sh.Logger.Info("Shutting down the server...")
-	err := sh.server.Shutdown(ctx)
+	err := srv.Shutdown(ctx)
+	cancel()
+
+	sh.mu.Lock()
+	sh.listener = nil
+	sh.mu.Unlock()
+
 	if err != nil {
-		sh.Logger.Error("Error shutting down the server: ", zap.Error(err))
+		sh.Logger.Error("Error shutting down the server", zap.Error(err))
 		return err
 	}
 	sh.Logger.Info("Server has been shut down successfully")
 	return nil
 }
 
+// Restart stops the running server and starts a new one on the same address.
+// Listening errors are returned; serving continues in the background.
 func (sh *ServerHTTP) Restart(ctx context.Context) error {
-
 	if err := sh.Stop(ctx); err != nil {
-		sh.Logger.Error("Error shutting down the server: ", zap.Error(err))
 		return err
 	}
 
-	sh.server = &http.Server{
-		Addr:    sh.server.Addr,
-		Handler: sh.server.Handler,
-	}
+	sh.mu.Lock()
+	sh.server = sh.newServer()
+	sh.mu.Unlock()
+	sh.draining.Store(false)
 
-	go func() {
-		err := sh.Start()
-		if err != nil && err != http.ErrServerClosed {
-			sh.Logger.Error("Could not listen on %s: %v\n", zap.String("address", sh.server.Addr), zap.Error(err))
-		}
-	}()
+	srv, ln, err := sh.listen()
+	if err != nil {
+		sh.Logger.Error("Error restarting HTTP server", zap.Error(err))
+		return err
+	}
 
+	go sh.serve(srv, ln)
 	return nil
 }
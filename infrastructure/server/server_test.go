@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const testAddr = "127.0.0.1:0"
+
+// waitListening polls until the server has bound its ephemeral port.
+func waitListening(t *testing.T, sh *ServerHTTP) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if addr := sh.Addr(); addr != testAddr {
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start listening")
+	return ""
+}
+
+func get(t *testing.T, addr, path string) string {
+	t.Helper()
+
+	resp, err := http.Get("http://" + addr + path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+	}
+	return string(body)
+}
+
+func TestStartStopRestart(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "pong")
+	})
+
+	sh := NewServerHTTP(zap.NewNop(), mux, testAddr, Options{DrainDelay: 300 * time.Millisecond})
+
+	started := make(chan error, 1)
+	go func() { started <- sh.Start() }()
+	addr := waitListening(t, sh)
+
+	if body := get(t, addr, "/ping"); body != "pong" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if err := sh.Ready(context.Background()); err != nil {
+		t.Fatalf("ready before stop: %v", err)
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- sh.Stop(context.Background()) }()
+
+	// During the drain delay readiness fails while requests are still served.
+	deadline := time.Now().Add(time.Second)
+	for sh.Ready(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("readiness did not report draining")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if body := get(t, addr, "/ping"); body != "pong" {
+		t.Fatalf("unexpected body while draining %q", body)
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := <-started; err != nil {
+		t.Fatalf("start returned %v after stop", err)
+	}
+	if _, err := http.Get("http://" + addr + "/ping"); err == nil {
+		t.Fatal("request succeeded after stop")
+	}
+
+	if err := sh.Restart(context.Background()); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if err := sh.Ready(context.Background()); err != nil {
+		t.Fatalf("ready after restart: %v", err)
+	}
+
+	addr = waitListening(t, sh)
+	if body := get(t, addr, "/ping"); body != "pong" {
+		t.Fatalf("unexpected body after restart %q", body)
+	}
+
+	if err := sh.Stop(context.Background()); err != nil {
+		t.Fatalf("final stop: %v", err)
+	}
+}
+
+func TestStopCancelsBaseContext(t *testing.T) {
+	entered := make(chan struct{})
+	cancelled := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		select {
+		case <-r.Context().Done():
+			cancelled <- r.Context().Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+	})
+
+	sh := NewServerHTTP(zap.NewNop(), mux, testAddr, Options{})
+	go func() { _ = sh.Start() }()
+	addr := waitListening(t, sh)
+
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow handler was not called")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sh.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("stop with a stuck handler returned %v, want deadline exceeded", err)
+	}
+
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("handler context error %v, want canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler context was not cancelled by stop")
+	}
+
+	if err := sh.Ready(context.Background()); err == nil {
+		t.Fatal("readiness did not report draining after stop")
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// GenerateSelfSigned creates a PEM encoded ECDSA certificate and key valid for
+// the given host names and IP addresses. The first host becomes the common
+// name, which is what Telegram checks for uploaded webhook certificates.
+func GenerateSelfSigned(hosts []string, validFor time.Duration) ([]byte, []byte, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost"}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// certificateStore hands the current certificate to every TLS handshake, so a
+// renewed certificate is picked up by Reload without restarting the listener.
+type certificateStore struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+}
+
+func newFileCertificateStore(certFile, keyFile string) (*certificateStore, error) {
+	cs := &certificateStore{certFile: certFile, keyFile: keyFile}
+	if err := cs.Reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func newSelfSignedCertificateStore(hosts []string) (*certificateStore, error) {
+	certPEM, keyPEM, err := GenerateSelfSigned(hosts, 365*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &certificateStore{}
+	if err := cs.set(certPEM, keyPEM); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// Reload reads the certificate files again. A generated certificate is kept
+// as is, since it may already be registered with Telegram.
+func (cs *certificateStore) Reload() error {
+	if cs.certFile == "" {
+		return nil
+	}
+
+	certPEM, err := os.ReadFile(cs.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(cs.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %w", err)
+	}
+
+	return cs.set(certPEM, keyPEM)
+}
+
+func (cs *certificateStore) set(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.cert = &cert
+	cs.certPEM = certPEM
+	return nil
+}
+
+func (cs *certificateStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cert, nil
+}
+
+func (cs *certificateStore) PEM() []byte {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.certPEM
+}
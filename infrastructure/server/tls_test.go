@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func writeCertificate(t *testing.T, certFile, keyFile string) []byte {
+	t.Helper()
+
+	certPEM, keyPEM, err := GenerateSelfSigned([]string{"127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateSelfSigned: %v", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	return block.Bytes
+}
+
+// presentedCertificate returns the DER of the leaf certificate the server
+// sends in a new handshake.
+func presentedCertificate(t *testing.T, addr string) []byte {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].Raw
+}
+
+func TestReloadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	first := writeCertificate(t, certFile, keyFile)
+
+	sh := NewServerHTTP(zap.NewNop(), http.NotFoundHandler(), testAddr, Options{CertFile: certFile, KeyFile: keyFile})
+	go func() { _ = sh.Start() }()
+	defer sh.Stop(context.Background())
+	addr := waitListening(t, sh)
+
+	if got := presentedCertificate(t, addr); !bytes.Equal(got, first) {
+		t.Fatal("server does not present the first certificate")
+	}
+
+	second := writeCertificate(t, certFile, keyFile)
+	if got := presentedCertificate(t, addr); !bytes.Equal(got, first) {
+		t.Fatal("certificate changed before ReloadCertificate")
+	}
+
+	if err := sh.ReloadCertificate(); err != nil {
+		t.Fatalf("ReloadCertificate: %v", err)
+	}
+	if got := presentedCertificate(t, addr); !bytes.Equal(got, second) {
+		t.Fatal("server does not present the second certificate after reload")
+	}
+
+	certPEM, err := sh.Certificate()
+	if err != nil {
+		t.Fatalf("Certificate: %v", err)
+	}
+	if block, _ := pem.Decode(certPEM); !bytes.Equal(block.Bytes, second) {
+		t.Fatal("Certificate does not return the reloaded certificate")
+	}
+}
@@ -0,0 +1,153 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ReadRows returns all rows of a CSV or XLSX file; the format is chosen by the
+// file extension. For XLSX only the first sheet is read.
+func ReadRows(fileName string, r io.Reader) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return readCSV(r)
+	case ".xlsx":
+		return readXLSX(r)
+	default:
+		return nil, fmt.Errorf("unsupported file format %q, expected .csv or .xlsx", filepath.Ext(fileName))
+	}
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csv: %w", err)
+	}
+	return rows, nil
+}
+
+// detectDelimiter picks ';' for spreadsheets exported with a Russian locale
+// and ',' otherwise.
+func detectDelimiter(data []byte) rune {
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	file, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open xlsx: %w", err)
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("xlsx file has no sheets")
+	}
+
+	rows, err := file.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %q: %w", sheets[0], err)
+	}
+	raw, err := file.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %q: %w", sheets[0], err)
+	}
+
+	// Date cells are shown in the workbook's format, e.g. mm-dd-yy, which
+	// text parsing would read as dd-mm. They are converted from the stored
+	// serial number to YYYY-MM-DD instead.
+	props, err := file.GetWorkbookProps()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workbook properties: %w", err)
+	}
+	date1904 := props.Date1904 != nil && *props.Date1904
+	dateStyles := make(map[int]bool)
+	for r, row := range rows {
+		for c, value := range row {
+			if r >= len(raw) || c >= len(raw[r]) || raw[r][c] == value {
+				continue
+			}
+			serial, err := strconv.ParseFloat(raw[r][c], 64)
+			if err != nil {
+				continue
+			}
+			cell, err := excelize.CoordinatesToCellName(c+1, r+1)
+			if err != nil {
+				return nil, err
+			}
+			styleID, err := file.GetCellStyle(sheets[0], cell)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read style of %s: %w", cell, err)
+			}
+			isDate, ok := dateStyles[styleID]
+			if !ok {
+				style, err := file.GetStyle(styleID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read style of %s: %w", cell, err)
+				}
+				isDate = isDateFormat(style.NumFmt, style.CustomNumFmt)
+				dateStyles[styleID] = isDate
+			}
+			if !isDate {
+				continue
+			}
+			date, err := excelize.ExcelDateToTime(serial, date1904)
+			if err != nil {
+				continue
+			}
+			rows[r][c] = date.Format("2006-01-02")
+		}
+	}
+	return rows, nil
+}
+
+// isDateFormat tells date number formats: the built-in ones by ID, custom
+// ones by a day or year code outside quoted text and [...] sections.
+func isDateFormat(numFmt int, custom *string) bool {
+	if custom == nil || *custom == "" {
+		return (numFmt >= 14 && numFmt <= 17) || numFmt == 22 ||
+			(numFmt >= 27 && numFmt <= 36) || (numFmt >= 50 && numFmt <= 58)
+	}
+
+	inQuotes, inBrackets := false, false
+	for _, r := range strings.ToLower(*custom) {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case r == '[':
+			inBrackets = true
+		case r == ']':
+			inBrackets = false
+		case inBrackets:
+		case r == 'd' || r == 'y':
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package workcalendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rutube/infrastructure/spreadsheet"
+	"strings"
+	"time"
+)
+
+// Policies for an event that falls on a non-working day.
+const (
+	PolicyNone     = "none"
+	PolicyPrevious = "previous"
+	PolicyNext     = "next"
+)
+
+// MaxShift bounds the search for a working day; the longest Russian holiday
+// stretch is about ten days.
+const MaxShift = 31
+
+// Calendar tells working days from non-working ones. Without a production
+// calendar file only Saturdays and Sundays are days off.
+type Calendar struct {
+	holidays map[string]bool
+	workdays map[string]bool
+}
+
+// calendarFile is the JSON layout: days off that fall on weekdays, and
+// weekends that were made working days by a transfer.
+type calendarFile struct {
+	Holidays []string `json:"holidays"`
+	Workdays []string `json:"workdays"`
+}
+
+func New() *Calendar {
+	return &Calendar{
+		holidays: make(map[string]bool),
+		workdays: make(map[string]bool),
+	}
+}
+
+// Load reads a production calendar from a .json or .csv file. A CSV row is a
+// date followed by an optional "holiday" (the default) or "workday"; dates are
+// YYYY-MM-DD or DD.MM.YYYY.
+func Load(path string) (*Calendar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open calendar: %w", err)
+	}
+	defer file.Close()
+
+	var data calendarFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(file).Decode(&data); err != nil {
+			return nil, fmt.Errorf("failed to parse calendar: %w", err)
+		}
+	case ".csv":
+		rows, err := spreadsheet.ReadRows(path, file)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+				continue
+			}
+			kind := "holiday"
+			if len(row) > 1 && strings.TrimSpace(row[1]) != "" {
+				kind = strings.ToLower(strings.TrimSpace(row[1]))
+			}
+			switch kind {
+			case "holiday":
+				data.Holidays = append(data.Holidays, row[0])
+			case "workday":
+				data.Workdays = append(data.Workdays, row[0])
+			default:
+				// A header row is allowed.
+				if i == 0 {
+					continue
+				}
+				return nil, fmt.Errorf("calendar row %d: unknown day type %q", i+1, row[1])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported calendar format %q, expected .json or .csv", filepath.Ext(path))
+	}
+
+	calendar := New()
+	for _, value := range data.Holidays {
+		day, err := parseDay(value)
+		if err != nil {
+			return nil, err
+		}
+		calendar.holidays[day] = true
+	}
+	for _, value := range data.Workdays {
+		day, err := parseDay(value)
+		if err != nil {
+			return nil, err
+		}
+		calendar.workdays[day] = true
+	}
+	return calendar, nil
+}
+
+func parseDay(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "02.01.2006"} {
+		if day, err := time.Parse(layout, value); err == nil {
+			return day.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid calendar date %q", value)
+}
+
+func (c *Calendar) IsWorkingDay(day time.Time) bool {
+	key := day.Format("2006-01-02")
+	if c.workdays[key] {
+		return true
+	}
+	if c.holidays[key] {
+		return false
+	}
+	return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+}
+
+// Shift moves a non-working day to the previous or next working day according
+// to policy. Working days and PolicyNone leave the day unchanged.
+func (c *Calendar) Shift(day time.Time, policy string) time.Time {
+	step := 0
+	switch policy {
+	case PolicyPrevious:
+		step = -1
+	case PolicyNext:
+		step = 1
+	default:
+		return day
+	}
+
+	for i := 0; i < MaxShift && !c.IsWorkingDay(day); i++ {
+		day = day.AddDate(0, 0, step)
+	}
+	return day
+}
+
+func ValidPolicy(policy string) bool {
+	return policy == PolicyNone || policy == PolicyPrevious || policy == PolicyNext
+}
@@ -0,0 +1,73 @@
+package workcalendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func day(value string) time.Time {
+	d, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestShift(t *testing.T) {
+	// 9-10 May 2030 are holidays next to a weekend, Saturday 4 May is a
+	// working day by transfer.
+	calendar := New()
+	calendar.holidays["2030-05-09"] = true
+	calendar.holidays["2030-05-10"] = true
+	calendar.workdays["2030-05-04"] = true
+
+	tests := []struct {
+		day    string
+		policy string
+		want   string
+	}{
+		{day: "2030-05-08", policy: PolicyNext, want: "2030-05-08"},
+		{day: "2030-05-11", policy: PolicyPrevious, want: "2030-05-08"},
+		{day: "2030-05-11", policy: PolicyNext, want: "2030-05-13"},
+		{day: "2030-05-09", policy: PolicyPrevious, want: "2030-05-08"},
+		{day: "2030-05-09", policy: PolicyNext, want: "2030-05-13"},
+		{day: "2030-05-04", policy: PolicyNext, want: "2030-05-04"},
+		{day: "2030-05-05", policy: PolicyPrevious, want: "2030-05-04"},
+		{day: "2030-05-11", policy: PolicyNone, want: "2030-05-11"},
+		{day: "2030-05-11", policy: "", want: "2030-05-11"},
+	}
+
+	for _, tt := range tests {
+		got := calendar.Shift(day(tt.day), tt.policy).Format("2006-01-02")
+		if got != tt.want {
+			t.Errorf("Shift(%s, %q) = %s, want %s", tt.day, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calendar.csv")
+	data := "date,type\n09.05.2030,holiday\n2030-05-10\n2030-05-04,workday\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	for value, want := range map[string]bool{
+		"2030-05-04": true,
+		"2030-05-08": true,
+		"2030-05-09": false,
+		"2030-05-10": false,
+		"2030-05-11": false,
+	} {
+		if got := calendar.IsWorkingDay(day(value)); got != want {
+			t.Errorf("IsWorkingDay(%s) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -2,62 +2,155 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"rutube/controller"
 	telegramconnect "rutube/infrastructure/TelegramConnect"
+	"rutube/infrastructure/config"
 	"rutube/infrastructure/database"
+	"rutube/infrastructure/health"
+	"rutube/infrastructure/metrics"
+	"rutube/infrastructure/outbox"
 	"rutube/infrastructure/router"
+	"rutube/infrastructure/scheduler"
 	"rutube/infrastructure/server"
+	"rutube/infrastructure/workcalendar"
 	"rutube/usecase"
 	"syscall"
 	"time"
+	// User time zones must resolve on hosts without a zoneinfo database.
+	_ "time/tzdata"
 
-	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
-func init() {
-	err := godotenv.Load()
+func main() {
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		fmt.Println("Invalid configuration. detailed information - ", err.Error())
+		os.Exit(1)
 	}
-}
 
-func main() {
-	logger, err := zap.NewProduction()
+	logger, err := newLogger(cfg)
 	if err != nil {
 		fmt.Println("Error starting logger. detailed information - ", err.Error())
 		os.Exit(1)
 	}
 
-	db, err := database.InitDatabase("Date.db")
+	if len(os.Args) > 1 {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if err := runCommand(ctx, logger, cfg, os.Args[1:]); err != nil {
+			logger.Error("Command failed", zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	logger.Info("Effective configuration", zap.Object("config", cfg.Redacted()))
+
+	db, err := database.InitDatabase(cfg.Database.Driver, cfg.Database.DSN, cfg.Database.Options())
 	if err != nil {
 		logger.Error("Database initialization error", zap.Error(err))
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	tg, err := telegramconnect.NewTelegramClient(logger)
+	tg, err := telegramconnect.NewTelegramClient(logger, cfg.Telegram.Token)
 	if err != nil {
 		logger.Error("Telegram client initialization error", zap.Error(err))
 		os.Exit(1)
 	}
 
+	calendar := workcalendar.New()
+	if cfg.Calendar.File != "" {
+		calendar, err = workcalendar.Load(cfg.Calendar.File)
+		if err != nil {
+			logger.Error("Production calendar loading error", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+
 	dbService := database.NewDatabase(logger, db)
-	useCase := usecase.NewUseCase(logger, dbService, tg)
+	metrics.RegisterStats(logger, dbService)
+	useCase := usecase.NewUseCase(logger, dbService, tg, usecase.Options{
+		AdminIDs:  cfg.Admin.TelegramIDs,
+		PublicURL: cfg.PublicURL,
+		Reminders: usecase.ReminderOptions{
+			Hour:       cfg.Scheduler.ReminderHour,
+			DaysBefore: cfg.Scheduler.ReminderDaysBefore,
+
+			Calendar:      calendar,
+			DefaultPolicy: cfg.Calendar.DefaultPolicy,
+			TeamPolicies:  cfg.Calendar.TeamPolicies,
+			Location:      cfg.Scheduler.Location(),
+		},
+	})
 	handler := controller.NewHandlers(logger, useCase)
-	rtr := router.NewGoChiRouting(logger, handler)
-	srv := server.NewServerHTTP(logger, rtr, ":8080")
+	apiHandler := controller.NewAPIHandlers(logger, useCase)
+	checker := health.NewChecker()
+	healthHandler := controller.NewHealthHandlers(logger, checker)
+	rtr := router.NewGoChiRouting(logger, handler, apiHandler, healthHandler, cfg.Admin.APIToken)
+	srv := server.NewServerHTTP(logger, rtr, cfg.HTTP.Addr, cfg.ServerOptions())
+
+	if cfg.Telegram.WebhookURL != "" {
+		if err := registerWebhook(cfg, tg, srv); err != nil {
+			logger.Error("Webhook registration error", zap.Error(err))
+			os.Exit(1)
+		}
+	}
+
+	outboxOptions := cfg.Outbox.Options()
+	outboxOptions.Location = cfg.Scheduler.Location()
+	sender := outbox.NewSender(logger, dbService, tg, outboxOptions)
+	sender.Start()
+	defer sender.Stop()
+
+	sched := scheduler.NewScheduler(logger)
+	sched.Add("backup", cfg.Scheduler.BackupInterval, func(ctx context.Context) error {
+		return useCase.RunBackup(ctx, cfg.Scheduler.BackupDir, cfg.Scheduler.BackupKeep)
+	})
+	sched.Add("reminders", cfg.Scheduler.ReminderInterval, func(ctx context.Context) error {
+		now := time.Now()
+		if err := useCase.QueueReminders(ctx, now); err != nil {
+			return err
+		}
+		if err := useCase.QueueDigests(ctx, now); err != nil {
+			return err
+		}
+		return useCase.QueueFundSummaries(ctx, now)
+	})
+	sched.Add("profile-sync", cfg.Scheduler.ProfileSyncInterval, useCase.SyncProfiles)
+	sched.Add("pending-birthdays", time.Hour, useCase.ExpirePendingBirthdays)
+	sched.Add("outbox-prune", 24*time.Hour, func(ctx context.Context) error {
+		return sender.Prune(ctx, cfg.Outbox.Retention)
+	})
+	sched.Start()
+	defer sched.Stop()
+
+	checker.Add("server", srv.Ready)
+	checker.Add("database", dbService.Ping)
+	checker.Add("telegram", tg.Ping)
+	checker.Add("scheduler", sched.Heartbeat)
 
 	go func() {
-		if err := srv.Start(); err != nil {
+		if err := srv.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Error("Error starting the server", zap.Error(err))
 		}
 	}()
 
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			srv.ReloadCertificate()
+		}
+	}()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
@@ -65,7 +158,7 @@ func main() {
 
 	logger.Info("Shutting down the server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.DrainDelay+cfg.HTTP.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Stop(ctx); err != nil {
@@ -74,3 +167,26 @@ func main() {
 
 	logger.Info("Server exiting")
 }
+
+func registerWebhook(cfg config.Config, tg *telegramconnect.TelegramClient, srv *server.ServerHTTP) error {
+	var certificate []byte
+	if cfg.Telegram.UploadCertificate {
+		cert, err := srv.Certificate()
+		if err != nil {
+			return err
+		}
+		certificate = cert
+	}
+
+	return tg.SetWebhook(context.Background(), cfg.Telegram.WebhookURL, certificate)
+}
+
+func newLogger(cfg config.Config) (*zap.Logger, error) {
+	zapConfig := zap.NewProductionConfig()
+	if cfg.Mode == config.ModeDevelopment {
+		zapConfig = zap.NewDevelopmentConfig()
+	}
+	zapConfig.Level = zap.NewAtomicLevelAt(cfg.ZapLevel())
+
+	return zapConfig.Build()
+}
@@ -1,16 +1,368 @@
 package models
 
+import "time"
+
 type ShortUserInfo struct {
-	ID        int
-	IDTG      int
-	FirstName string
-	LastName  string
-	BirthDate string
+	ID        int    `json:"id"`
+	IDTG      int    `json:"telegram_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	BirthDate string `json:"birth_date"`
+	Username  string `json:"username"`
+	// BirthdaySource is where BirthDate came from, one of the BirthdaySource*
+	// constants; empty when no birthday is known.
+	BirthdaySource string `json:"birthday_source,omitempty"`
+	// BioSync is the user's consent to re-read the birthday from their Bio.
+	BioSync bool `json:"bio_sync,omitempty"`
+	// Inactive users have blocked the bot: they get no messages, but their
+	// birthday is still shown to others.
+	Inactive bool `json:"inactive,omitempty"`
+	// Team picks the calendar policy for events that fall on a day off.
+	Team string `json:"team,omitempty"`
+}
+
+// UserPatch lists the fields of a user to change; nil fields keep their
+// current value, an empty string clears the field.
+type UserPatch struct {
+	FirstName *string
+	LastName  *string
+	BirthDate *string
+	Username  *string
+	Team      *string
+}
+
+const (
+	BirthdaySourceManual = "manual"
+	BirthdaySourceBio    = "bio"
+	BirthdaySourceImport = "import"
+	BirthdaySourceAdmin  = "admin"
+)
+
+type CalendarToken struct {
+	TelegramID int    `json:"telegram_id"`
+	Token      string `json:"token"`
+}
+
+// WishlistItem is a gift idea; URL is the link found in the text, if any.
+type WishlistItem struct {
+	ID         int64  `json:"id"`
+	TelegramID int64  `json:"telegram_id"`
+	Text       string `json:"text"`
+	URL        string `json:"url,omitempty"`
+}
+
+// Settings are a user's preferences; users who never changed them get
+// DefaultSettings.
+type Settings struct {
+	TelegramID int64  `json:"telegram_id"`
+	Language   string `json:"language"`
+	// TimeZone is an IANA zone name; empty means the bot's default zone.
+	TimeZone string `json:"time_zone"`
+	// NotifyHour is the local hour from which reminders go out; -1 follows
+	// the bot's configured hour.
+	NotifyHour int `json:"notify_hour"`
+	// ReminderOffsets are the days before an event for advance reminders;
+	// nil follows the bot's configuration, empty turns them off.
+	ReminderOffsets []int `json:"reminder_offsets"`
+	// A digest replaces individual reminders with a summary on Monday
+	// (weekly) and/or on the first of the month (monthly).
+	DigestWeekly  bool `json:"digest_weekly"`
+	DigestMonthly bool `json:"digest_monthly"`
+	// Privacy is the visibility of the user's events, one of the Visibility*
+	// constants.
+	Privacy string `json:"privacy"`
+	// QuietFrom and QuietTo are local hours without notifications, QuietTo
+	// excluded; equal values mean no quiet hours.
+	QuietFrom int `json:"quiet_from"`
+	QuietTo   int `json:"quiet_to"`
+	// VacationFrom and VacationTo are inclusive YYYY-MM-DD dates without
+	// notifications; empty means no vacation.
+	VacationFrom string `json:"vacation_from"`
+	VacationTo   string `json:"vacation_to"`
+}
+
+const (
+	LanguageRussian = "ru"
+	LanguageEnglish = "en"
+)
+
+func DefaultSettings(telegramID int64) Settings {
+	return Settings{
+		TelegramID: telegramID,
+		Language:   LanguageRussian,
+		NotifyHour: -1,
+		Privacy:    VisibilityPublic,
+	}
+}
+
+func (s Settings) Digest() bool {
+	return s.DigestWeekly || s.DigestMonthly
+}
+
+// Location returns the user's time zone, or fallback when none is set.
+func (s Settings) Location(fallback *time.Location) *time.Location {
+	if s.TimeZone == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// QuietUntil reports whether notifications are held back at now, given in the
+// user's time zone, and when the quiet hours or vacation end. A vacation may
+// end inside quiet hours and the other way round, hence the loop.
+func (s Settings) QuietUntil(now time.Time) (time.Time, bool) {
+	until := now
+	for i := 0; i < 3; i++ {
+		day := until.Format("2006-01-02")
+		if s.VacationFrom != "" && s.VacationFrom <= day && day <= s.VacationTo {
+			last, err := time.ParseInLocation("2006-01-02", s.VacationTo, until.Location())
+			if err == nil {
+				until = last.AddDate(0, 0, 1)
+			}
+		}
+		if s.inQuietHours(until.Hour()) {
+			end := time.Date(until.Year(), until.Month(), until.Day(), s.QuietTo, 0, 0, 0, until.Location())
+			if !end.After(until) {
+				end = end.AddDate(0, 0, 1)
+			}
+			until = end
+		}
+	}
+	return until, until.After(now)
+}
+
+func (s Settings) inQuietHours(hour int) bool {
+	switch {
+	case s.QuietFrom == s.QuietTo:
+		return false
+	case s.QuietFrom < s.QuietTo:
+		return hour >= s.QuietFrom && hour < s.QuietTo
+	default:
+		return hour >= s.QuietFrom || hour < s.QuietTo
+	}
+}
+
+type Archive struct {
+	Version        int             `json:"version"`
+	CreatedAt      string          `json:"created_at"`
+	Users          []ShortUserInfo `json:"users"`
+	Subscriptions  []Subscription  `json:"subscriptions"`
+	CalendarTokens []CalendarToken `json:"calendar_tokens"`
+	Wishlist       []WishlistItem  `json:"wishlist"`
+	Events         []Event         `json:"events"`
+	Settings       []Settings      `json:"settings"`
+	// Since version 5.
+	Funds            []Fund            `json:"funds"`
+	Contributions    []Contribution    `json:"fund_contributions"`
+	PendingBirthdays []PendingBirthday `json:"pending_birthdays"`
+	AuditLog         []AuditEntry      `json:"audit_log"`
+}
+
+type PersonalData struct {
+	ExportedAt          string         `json:"exported_at"`
+	User                ShortUserInfo  `json:"user"`
+	SubscribedTo        []Subscription `json:"subscribed_to"`
+	Subscribers         []Subscription `json:"subscribers"`
+	CalendarFeedEnabled bool           `json:"calendar_feed_enabled"`
+	Wishlist            []WishlistItem `json:"wishlist"`
+	Events              []Event        `json:"events"`
+	Settings            Settings       `json:"settings"`
+	AuditLog            []AuditEntry   `json:"audit_log"`
+}
+
+type ImportReport struct {
+	Total    int           `json:"total"`
+	Created  int           `json:"created"`
+	Updated  int           `json:"updated"`
+	Rejected []RejectedRow `json:"rejected"`
+}
+
+type RejectedRow struct {
+	Row    int    `json:"row"`
+	Reason string `json:"reason"`
+}
+
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int    `json:"file_size,omitempty"`
+}
+
+// Subscription covers the event types listed in EventTypes, or all of them
+// when the list is empty.
+type Subscription struct {
+	ID             int      `json:"id"`
+	SubscriberID   int64    `json:"subscriber_id"`
+	SubscribedToID int64    `json:"subscribed_to_id"`
+	EventTypes     []string `json:"event_types,omitempty"`
+}
+
+// Event is a recurring or one-off date of a user. A user has at most one
+// event of each type; the birthday is also exposed as ShortUserInfo.BirthDate.
+type Event struct {
+	ID         int64  `json:"id"`
+	UserID     int    `json:"user_id"`
+	TelegramID int    `json:"telegram_id"`
+	Type       string `json:"type"`
+	Date       string `json:"date"`
+	Recurrence string `json:"recurrence"`
+	Visibility string `json:"visibility"`
+	Source     string `json:"source,omitempty"`
+}
+
+const (
+	EventBirthday        = "birthday"
+	EventWorkAnniversary = "work_anniversary"
+	EventNameDay         = "name_day"
+)
+
+var EventTypes = []string{EventBirthday, EventWorkAnniversary, EventNameDay}
+
+const (
+	RecurrenceYearly = "yearly"
+	RecurrenceOnce   = "once"
+)
+
+// Public events are listed to everyone, subscriber events only to
+// subscribers; private events are kept for the user alone and never announced.
+const (
+	VisibilityPublic      = "public"
+	VisibilitySubscribers = "subscribers"
+	VisibilityPrivate     = "private"
+)
+
+type UpcomingBirthday struct {
+	User ShortUserInfo `json:"user"`
+	Date string        `json:"date"`
+	Age  int           `json:"age"`
+}
+
+// Fund is a gift collection for BirthdayID's birthday on Date, run by
+// OrganiserID. Nothing about it is ever shown to the birthday person.
+type Fund struct {
+	ID          int64  `json:"id"`
+	BirthdayID  int64  `json:"birthday_id"`
+	OrganiserID int64  `json:"organiser_id"`
+	Date        string `json:"date"`
+	Closed      bool   `json:"closed"`
+}
+
+type Contribution struct {
+	FundID     int64 `json:"fund_id"`
+	TelegramID int64 `json:"telegram_id"`
+	Amount     int   `json:"amount"`
+	Paid       bool  `json:"paid"`
+}
+
+// AuditEntry is one record of the append-only audit log. TelegramID is the
+// user whose data changed; RelatedID is the other side of a subscription.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TelegramID int64     `json:"telegram_id"`
+	RelatedID  int64     `json:"related_id,omitempty"`
+	OldValue   string    `json:"old_value,omitempty"`
+	NewValue   string    `json:"new_value,omitempty"`
+	Source     string    `json:"source,omitempty"`
+}
+
+// AuditFilter selects audit entries; zero fields do not filter.
+type AuditFilter struct {
+	TelegramID int64
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+const (
+	AuditUserCreated     = "user_created"
+	AuditUserUpdated     = "user_updated"
+	AuditUserDeleted     = "user_deleted"
+	AuditBirthdayChanged = "birthday_changed"
+	AuditEventChanged    = "event_changed"
+	AuditSubscribed      = "subscribed"
+	AuditUnsubscribed    = "unsubscribed"
+	// AuditSubscriptionChanged is a change of the event types subscribed to.
+	AuditSubscriptionChanged = "subscription_changed"
+	AuditBackupExported      = "backup_exported"
+	AuditArchiveRestored     = "archive_restored"
+	AuditImport              = "import"
+)
+
+const (
+	OutboxPending       = "pending"
+	OutboxSent          = "sent"
+	OutboxFailed        = "failed"
+	OutboxUndeliverable = "undeliverable"
+)
+
+type OutboxMessage struct {
+	ID       int64
+	ChatID   int64
+	Text     string
+	DedupKey string
+	Status   string
+	Attempts int
+	// Deferred messages were held back by quiet hours or a vacation and go
+	// out together in one catch-up message.
+	Deferred bool
+}
+
+// ChatMemberUpdated is sent as my_chat_member when a user blocks or unblocks
+// the bot in a private chat.
+type ChatMemberUpdated struct {
+	Chat struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	} `json:"chat"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	NewChatMember struct {
+		Status string `json:"status"`
+	} `json:"new_chat_member"`
+}
+
+// PendingBirthday is a detected birth date waiting for the user to confirm it.
+type PendingBirthday struct {
+	TelegramID int       `json:"telegram_id"`
+	BirthDate  string    `json:"birth_date"`
+	Source     string    `json:"source"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Button is an inline keyboard button; Data comes back in a callback query.
+type Button struct {
+	Text string
+	Data string
+}
+
+type CallbackQuery struct {
+	ID   string `json:"id"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Message *struct {
+		MessageID int `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message,omitempty"`
+	Data string `json:"data,omitempty"`
 }
 
 type UserInfo struct {
-	UpdateID int `json:"update_id"`
-	Message  struct {
+	UpdateID      int                `json:"update_id"`
+	MyChatMember  *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+	CallbackQuery *CallbackQuery     `json:"callback_query,omitempty"`
+	Message       struct {
 		MessageID int `json:"message_id"`
 		From      struct {
 			ID           int64  `json:"id"`
@@ -28,8 +380,10 @@ type UserInfo struct {
 			Username  string `json:"username,omitempty"`
 			Type      string `json:"type"`
 		} `json:"chat"`
-		Date     int    `json:"date"`
-		Text     string `json:"text,omitempty"`
+		Date     int       `json:"date"`
+		Text     string    `json:"text,omitempty"`
+		Caption  string    `json:"caption,omitempty"`
+		Document *Document `json:"document,omitempty"`
 		Entities []struct {
 			Offset int    `json:"offset"`
 			Length int    `json:"length"`
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsQuietUntil(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2030, time.May, day, hour, minute, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name      string
+		settings  Settings
+		now       time.Time
+		wantUntil time.Time
+		wantQuiet bool
+	}{
+		{
+			name:      "before midnight in a window across midnight",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8},
+			now:       at(10, 23, 30),
+			wantUntil: at(11, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "after midnight in a window across midnight",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8},
+			now:       at(10, 3, 0),
+			wantUntil: at(10, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "start hour is quiet",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8},
+			now:       at(10, 22, 0),
+			wantUntil: at(11, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "end hour is not quiet",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8},
+			now:       at(10, 8, 0),
+			wantUntil: at(10, 8, 0),
+		},
+		{
+			name:      "daytime outside a window across midnight",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8},
+			now:       at(10, 12, 0),
+			wantUntil: at(10, 12, 0),
+		},
+		{
+			name:      "window within a day",
+			settings:  Settings{QuietFrom: 13, QuietTo: 14},
+			now:       at(10, 13, 30),
+			wantUntil: at(10, 14, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "no quiet hours",
+			settings:  Settings{},
+			now:       at(10, 3, 0),
+			wantUntil: at(10, 3, 0),
+		},
+		{
+			name:      "equal start and end",
+			settings:  Settings{QuietFrom: 5, QuietTo: 5},
+			now:       at(10, 5, 30),
+			wantUntil: at(10, 5, 30),
+		},
+		{
+			name:      "vacation",
+			settings:  Settings{VacationFrom: "2030-05-10", VacationTo: "2030-05-12"},
+			now:       at(11, 12, 0),
+			wantUntil: at(13, 0, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "vacation ends inside quiet hours",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8, VacationFrom: "2030-05-10", VacationTo: "2030-05-12"},
+			now:       at(11, 12, 0),
+			wantUntil: at(13, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "quiet hours end inside a vacation",
+			settings:  Settings{QuietFrom: 22, QuietTo: 8, VacationFrom: "2030-05-10", VacationTo: "2030-05-12"},
+			now:       at(9, 23, 0),
+			wantUntil: at(13, 8, 0),
+			wantQuiet: true,
+		},
+		{
+			name:      "past vacation",
+			settings:  Settings{VacationFrom: "2030-05-01", VacationTo: "2030-05-03"},
+			now:       at(10, 12, 0),
+			wantUntil: at(10, 12, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet := tt.settings.QuietUntil(tt.now)
+			if quiet != tt.wantQuiet || !until.Equal(tt.wantUntil) {
+				t.Errorf("QuietUntil(%s) = %s, %v; want %s, %v", tt.now, until, quiet, tt.wantUntil, tt.wantQuiet)
+			}
+		})
+	}
+}
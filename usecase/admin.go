@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxBirthdayRange = 366 * 24 * time.Hour
+
+func (uc *UseCase) ListUsers(ctx context.Context) ([]models.ShortUserInfo, error) {
+	users, err := uc.db.SetAllUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	if users == nil {
+		users = []models.ShortUserInfo{}
+	}
+	return users, nil
+}
+
+func (uc *UseCase) GetUser(ctx context.Context, telegramID int) (models.ShortUserInfo, error) {
+	user, err := uc.db.FindUserByID(ctx, telegramID)
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return models.ShortUserInfo{}, fmt.Errorf("user %d: %w", telegramID, ErrNotFound)
+	}
+	return user, nil
+}
+
+// GetUserByUsername also finds users imported without a telegram_id, which
+// GetUser cannot reach; a leading @ is ignored.
+func (uc *UseCase) GetUserByUsername(ctx context.Context, username string) (models.ShortUserInfo, error) {
+	username = normalizeUsername(username)
+	if username == "" {
+		return models.ShortUserInfo{}, fmt.Errorf("%w: username is required", ErrInvalidInput)
+	}
+
+	user, err := uc.db.FindUserByUsername(ctx, username)
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("error finding user: %w", err)
+	}
+	if user.ID == 0 {
+		return models.ShortUserInfo{}, fmt.Errorf("user @%s: %w", username, ErrNotFound)
+	}
+	return user, nil
+}
+
+func (uc *UseCase) CreateUser(ctx context.Context, user models.ShortUserInfo) (models.ShortUserInfo, error) {
+	user, err := normalizeUser(user)
+	if err != nil {
+		return models.ShortUserInfo{}, err
+	}
+
+	existing, err := uc.db.FindUserByID(ctx, user.IDTG)
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("error finding user: %w", err)
+	}
+	if existing.IDTG != 0 {
+		return models.ShortUserInfo{}, fmt.Errorf("user %d: %w", user.IDTG, ErrAlreadyExists)
+	}
+	if user.BirthDate != "" {
+		user.BirthdaySource = models.BirthdaySourceAdmin
+	}
+
+	err = uc.db.InsertUser(ctx, user)
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("error creating user: %w", err)
+	}
+
+	return uc.GetUser(ctx, user.IDTG)
+}
+
+// UpdateUser changes only the fields present in the patch.
+func (uc *UseCase) UpdateUser(ctx context.Context, telegramID int, patch models.UserPatch) (models.ShortUserInfo, error) {
+	existing, err := uc.GetUser(ctx, telegramID)
+	if err != nil {
+		return models.ShortUserInfo{}, err
+	}
+
+	user := existing
+	if patch.FirstName != nil {
+		user.FirstName = *patch.FirstName
+	}
+	if patch.LastName != nil {
+		user.LastName = *patch.LastName
+	}
+	if patch.BirthDate != nil {
+		user.BirthDate = *patch.BirthDate
+	}
+	if patch.Username != nil {
+		user.Username = *patch.Username
+	}
+	if patch.Team != nil {
+		user.Team = *patch.Team
+	}
+
+	user, err = normalizeUser(user)
+	if err != nil {
+		return models.ShortUserInfo{}, err
+	}
+
+	switch {
+	case user.BirthDate == "":
+		user.BirthdaySource = ""
+	case user.BirthDate == existing.BirthDate:
+		user.BirthdaySource = existing.BirthdaySource
+	default:
+		user.BirthdaySource = models.BirthdaySourceAdmin
+	}
+
+	err = uc.db.UpdateUser(ctx, user)
+	if err != nil {
+		return models.ShortUserInfo{}, fmt.Errorf("error updating user: %w", err)
+	}
+
+	return uc.GetUser(ctx, user.IDTG)
+}
+
+func (uc *UseCase) DeleteUser(ctx context.Context, telegramID int) error {
+	if _, err := uc.GetUser(ctx, telegramID); err != nil {
+		return err
+	}
+
+	err := uc.db.DeleteUser(ctx, telegramID)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	return nil
+}
+
+func (uc *UseCase) ListSubscriptions(ctx context.Context, subscriberID int64) ([]models.Subscription, error) {
+	subscriptions, err := uc.db.ListSubscriptions(ctx, subscriberID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing subscriptions: %w", err)
+	}
+	if subscriptions == nil {
+		subscriptions = []models.Subscription{}
+	}
+	return subscriptions, nil
+}
+
+func (uc *UseCase) CreateSubscription(ctx context.Context, subscriberID, subscribedToID int64) error {
+	if subscriberID == subscribedToID {
+		return fmt.Errorf("%w: subscriber and target must differ", ErrInvalidInput)
+	}
+	if _, err := uc.GetUser(ctx, int(subscriberID)); err != nil {
+		return err
+	}
+	if _, err := uc.GetUser(ctx, int(subscribedToID)); err != nil {
+		return err
+	}
+
+	subscribed, err := uc.db.IsSubscribed(ctx, subscriberID, subscribedToID)
+	if err != nil {
+		return fmt.Errorf("error checking subscription: %w", err)
+	}
+	if subscribed {
+		return fmt.Errorf("subscription %d -> %d: %w", subscriberID, subscribedToID, ErrAlreadyExists)
+	}
+
+	err = uc.db.SubscribeToBirthday(ctx, subscriberID, subscribedToID)
+	if err != nil {
+		return fmt.Errorf("error subscribing: %w", err)
+	}
+	return nil
+}
+
+func (uc *UseCase) DeleteSubscription(ctx context.Context, subscriberID, subscribedToID int64) error {
+	subscribed, err := uc.db.IsSubscribed(ctx, subscriberID, subscribedToID)
+	if err != nil {
+		return fmt.Errorf("error checking subscription: %w", err)
+	}
+	if !subscribed {
+		return fmt.Errorf("subscription %d -> %d: %w", subscriberID, subscribedToID, ErrNotFound)
+	}
+
+	err = uc.db.UnsubscribeFromBirthday(ctx, subscriberID, subscribedToID)
+	if err != nil {
+		return fmt.Errorf("error unsubscribing: %w", err)
+	}
+	return nil
+}
+
+func (uc *UseCase) UpcomingBirthdays(ctx context.Context, from, to time.Time) ([]models.UpcomingBirthday, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: 'to' is before 'from'", ErrInvalidInput)
+	}
+	if to.Sub(from) > maxBirthdayRange {
+		return nil, fmt.Errorf("%w: range must not exceed 366 days", ErrInvalidInput)
+	}
+
+	users, err := uc.db.SetAllUser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+
+	return upcomingBirthdays(users, from, to), nil
+}
+
+func upcomingBirthdays(users []models.ShortUserInfo, from, to time.Time) []models.UpcomingBirthday {
+	result := []models.UpcomingBirthday{}
+
+	for _, user := range users {
+		birthDate, err := time.Parse("2006-01-02", user.BirthDate)
+		if err != nil {
+			continue
+		}
+
+		for year := from.Year(); year <= to.Year(); year++ {
+			date := birthdayInYear(birthDate, year)
+			if date.Before(from) || date.After(to) {
+				continue
+			}
+			result = append(result, models.UpcomingBirthday{
+				User: user,
+				Date: date.Format("2006-01-02"),
+				Age:  year - birthDate.Year(),
+			})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Date < result[j].Date
+	})
+
+	return result
+}
+
+// birthdayInYear moves 29 February to 28 February in non-leap years.
+func birthdayInYear(birthDate time.Time, year int) time.Time {
+	day := birthDate.Day()
+	if birthDate.Month() == time.February && day == 29 && !isLeapYear(year) {
+		day = 28
+	}
+	return time.Date(year, birthDate.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+func normalizeUser(user models.ShortUserInfo) (models.ShortUserInfo, error) {
+	if user.IDTG <= 0 {
+		return models.ShortUserInfo{}, fmt.Errorf("%w: telegram_id is required", ErrInvalidInput)
+	}
+	user.Username = normalizeUsername(user.Username)
+	user.Team = strings.TrimSpace(user.Team)
+
+	if user.BirthDate != "" {
+		birthDate, err := findAndFormatDate(user.BirthDate)
+		if err != nil {
+			return models.ShortUserInfo{}, fmt.Errorf("%w: birth_date: %v", ErrInvalidInput, err)
+		}
+		user.BirthDate = birthDate
+	}
+
+	return user, nil
+}
@@ -0,0 +1,35 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"rutube/models"
+)
+
+func TestGetUserByUsername(t *testing.T) {
+	uc := testUseCase(t)
+	ctx := context.Background()
+
+	if _, err := uc.db.UpsertUser(ctx, models.ShortUserInfo{Username: "ivan", BirthDate: "1990-05-10", BirthdaySource: models.BirthdaySourceImport}); err != nil {
+		t.Fatalf("UpsertUser: %v", err)
+	}
+
+	for _, username := range []string{"ivan", "@Ivan"} {
+		user, err := uc.GetUserByUsername(ctx, username)
+		if err != nil {
+			t.Fatalf("GetUserByUsername(%q): %v", username, err)
+		}
+		if user.ID == 0 || user.IDTG != 0 || user.BirthDate != "1990-05-10" {
+			t.Errorf("GetUserByUsername(%q) = %+v", username, user)
+		}
+	}
+
+	if _, err := uc.GetUserByUsername(ctx, "petr"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown username: got %v, want ErrNotFound", err)
+	}
+	if _, err := uc.GetUserByUsername(ctx, "@"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("empty username: got %v, want ErrInvalidInput", err)
+	}
+}
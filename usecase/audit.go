@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"rutube/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// auditCommandLimit keeps the /audit reply within one Telegram message.
+	auditCommandLimit = 25
+)
+
+const auditHelp = "Журнал изменений:\n" +
+	"/audit [TelegramID] [с ДД-ММ-ГГГГ] [по ДД-ММ-ГГГГ] - последние записи, новые сверху"
+
+// AuditLog returns entries of the audit log, newest first.
+func (uc *UseCase) AuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return nil, fmt.Errorf("%w: 'to' is before 'from'", ErrInvalidInput)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	entries, err := uc.db.ListAudit(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit log: %w", err)
+	}
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+	return entries, nil
+}
+
+// Audit handles the admin command /audit. Dates are whole days in UTC.
+func (uc *UseCase) Audit(ctx context.Context, id int, param string) error {
+	if !uc.isAdmin(id) {
+		return uc.tg.Response(ctx, int64(id), "Команда доступна только администраторам.")
+	}
+
+	filter := models.AuditFilter{Limit: auditCommandLimit}
+	var dates []time.Time
+	for _, field := range strings.Fields(param) {
+		if telegramID, err := strconv.ParseInt(field, 10, 64); err == nil && filter.TelegramID == 0 {
+			filter.TelegramID = telegramID
+			continue
+		}
+		date, err := findAndFormatDate(field)
+		if err != nil || len(dates) == 2 {
+			return uc.tg.Response(ctx, int64(id), auditHelp)
+		}
+		day, _ := time.Parse("2006-01-02", date)
+		dates = append(dates, day)
+	}
+	if len(dates) > 0 {
+		filter.From = dates[0]
+	}
+	if len(dates) > 1 {
+		filter.To = dates[1].AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	entries, err := uc.AuditLog(ctx, filter)
+	if errors.Is(err, ErrInvalidInput) {
+		return uc.tg.Response(ctx, int64(id), "Дата окончания раньше даты начала.")
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return uc.tg.Response(ctx, int64(id), "Записей не найдено.")
+	}
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = formatAuditEntry(entry)
+	}
+	return uc.tg.Response(ctx, int64(id), strings.Join(lines, "\n"))
+}
+
+func formatAuditEntry(entry models.AuditEntry) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s UTC %s %s", entry.CreatedAt.Format("02.01.2006 15:04"), entry.Actor, entry.Action))
+	if entry.TelegramID != 0 {
+		sb.WriteString(fmt.Sprintf(" %d", entry.TelegramID))
+	}
+	if entry.RelatedID != 0 {
+		sb.WriteString(fmt.Sprintf(" → %d", entry.RelatedID))
+	}
+	if entry.OldValue != "" || entry.NewValue != "" {
+		sb.WriteString(fmt.Sprintf(": %s → %s", orDash(entry.OldValue), orDash(entry.NewValue)))
+	}
+	if entry.Source != "" {
+		sb.WriteString(fmt.Sprintf(" (%s)", entry.Source))
+	}
+	return sb.String()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "—"
+	}
+	return value
+}
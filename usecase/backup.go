@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rutube/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const ArchiveVersion = 5
+
+func (uc *UseCase) ExportArchive(ctx context.Context) (models.Archive, error) {
+	archive, err := uc.db.ExportArchive(ctx)
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("error exporting archive: %w", err)
+	}
+
+	archive.Version = ArchiveVersion
+	archive.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	err = uc.db.RecordAudit(ctx, models.AuditEntry{
+		Action:   models.AuditBackupExported,
+		NewValue: fmt.Sprintf("users: %d, subscriptions: %d", len(archive.Users), len(archive.Subscriptions)),
+	})
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("error recording audit entry: %w", err)
+	}
+	return archive, nil
+}
+
+func (uc *UseCase) RestoreArchive(ctx context.Context, archive models.Archive) error {
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return fmt.Errorf("%w: unsupported archive version %d", ErrInvalidInput, archive.Version)
+	}
+
+	err := uc.db.RestoreArchive(ctx, archive)
+	if err != nil {
+		return fmt.Errorf("error restoring archive: %w", err)
+	}
+
+	err = uc.db.RecordAudit(ctx, models.AuditEntry{
+		Action:   models.AuditArchiveRestored,
+		NewValue: fmt.Sprintf("users: %d, subscriptions: %d", len(archive.Users), len(archive.Subscriptions)),
+	})
+	if err != nil {
+		return fmt.Errorf("error recording audit entry: %w", err)
+	}
+
+	uc.Logger.Info("Archive restored",
+		zap.Int("users", len(archive.Users)),
+		zap.Int("subscriptions", len(archive.Subscriptions)),
+		zap.Int("wishlist", len(archive.Wishlist)),
+		zap.Int("events", len(archive.Events)),
+		zap.Int("settings", len(archive.Settings)),
+		zap.Int("funds", len(archive.Funds)),
+		zap.Int("audit_log", len(archive.AuditLog)))
+	return nil
+}
+
+func (uc *UseCase) BackupCase(ctx context.Context, id int) error {
+	if !uc.isAdmin(id) {
+		return uc.tg.Response(ctx, int64(id), "Команда доступна только администраторам.")
+	}
+
+	archive, err := uc.ExportArchive(ctx)
+	if err != nil {
+		uc.tg.Response(ctx, int64(id), "Не удалось создать резервную копию.")
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding archive: %w", err)
+	}
+
+	fileName := fmt.Sprintf("backup-%s.json", time.Now().UTC().Format("20060102T150405Z"))
+	caption := fmt.Sprintf("Пользователей: %d, подписок: %d", len(archive.Users), len(archive.Subscriptions))
+	return uc.tg.SendDocument(ctx, int64(id), fileName, data, caption)
+}
+
+func (uc *UseCase) RunBackup(ctx context.Context, dir string, keep int) error {
+	path, err := uc.db.CreateBackup(ctx, dir, keep)
+	if err != nil {
+		return fmt.Errorf("error creating backup: %w", err)
+	}
+
+	uc.Logger.Info("Database backup created", zap.String("path", path))
+	return nil
+}
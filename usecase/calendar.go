@@ -0,0 +1,205 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"rutube/models"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const calendarFileName = "birthdays.ics"
+
+func (uc *UseCase) SendCalendar(ctx context.Context, id int, param string) error {
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		uc.tg.Response(ctx, int64(id), "Сначала зарегистрируйтесь командой /start")
+		return nil
+	}
+
+	if uc.publicURL != "" && param != "file" {
+		token, err := uc.calendarToken(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		link := fmt.Sprintf("%s/calendar/%s.ics", strings.TrimRight(uc.publicURL, "/"), token)
+		text := fmt.Sprintf("Добавьте эту ссылку в Google Calendar или Outlook как подписку на календарь:\n%s\n\nЧтобы получить файл .ics, отправьте /calendar file", link)
+		return uc.tg.Response(ctx, int64(id), text)
+	}
+
+	users, err := uc.calendarBirthdays(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return uc.tg.Response(ctx, int64(id), "В календаре пока нет дней рождения: вы ни на кого не подписаны или коллеги скрыли свои даты. Подписаться можно командой /sub <TelegramID>")
+	}
+
+	return uc.tg.SendDocument(ctx, int64(id), calendarFileName, buildCalendar(users, time.Now()), "Дни рождения коллег, на которых вы подписаны")
+}
+
+func (uc *UseCase) CalendarFeed(ctx context.Context, token string) ([]byte, error) {
+	id, err := uc.db.FindUserByCalendarToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("error finding calendar token: %w", err)
+	}
+	if id == 0 {
+		return nil, fmt.Errorf("calendar: %w", ErrNotFound)
+	}
+
+	users, err := uc.calendarBirthdays(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildCalendar(users, time.Now()), nil
+}
+
+// calendarBirthdays returns the colleagues whose birthday goes into the
+// user's calendar, with BirthDate taken from the birthday event: only
+// subscriptions covering birthdays count, and private birthdays are skipped
+// like in reminders and digests.
+func (uc *UseCase) calendarBirthdays(ctx context.Context, id int) ([]models.ShortUserInfo, error) {
+	subscriptions, err := uc.db.ListSubscriptions(ctx, int64(id))
+	if err != nil {
+		return nil, fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	covered := make(map[int64]bool, len(subscriptions))
+	for _, sub := range subscriptions {
+		if coversEvent(sub, models.EventBirthday) {
+			covered[sub.SubscribedToID] = true
+		}
+	}
+	if len(covered) == 0 {
+		return nil, nil
+	}
+
+	events, err := uc.db.ListEvents(ctx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error listing events: %w", err)
+	}
+
+	birthdays := make(map[int]string)
+	for _, event := range events {
+		if event.Type != models.EventBirthday || event.Visibility == models.VisibilityPrivate || !covered[int64(event.TelegramID)] {
+			continue
+		}
+		birthdays[event.TelegramID] = event.Date
+	}
+
+	users, err := uc.db.ListSubscribedUsers(ctx, int64(id))
+	if err != nil {
+		return nil, fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	var result []models.ShortUserInfo
+	for _, user := range users {
+		date, ok := birthdays[user.IDTG]
+		if !ok {
+			continue
+		}
+		user.BirthDate = date
+		result = append(result, user)
+	}
+	return result, nil
+}
+
+func (uc *UseCase) calendarToken(ctx context.Context, id int) (string, error) {
+	token, err := uc.db.GetCalendarToken(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("error reading calendar token: %w", err)
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating calendar token: %w", err)
+	}
+	token = hex.EncodeToString(buf)
+
+	err = uc.db.SaveCalendarToken(ctx, id, token)
+	if err != nil {
+		return "", fmt.Errorf("error saving calendar token: %w", err)
+	}
+
+	uc.Logger.Info("Calendar token created", zap.Int("telegram_id", id))
+	return token, nil
+}
+
+func buildCalendar(users []models.ShortUserInfo, now time.Time) []byte {
+	var sb strings.Builder
+
+	writeLine := func(line string) {
+		sb.WriteString(foldICSLine(line))
+		sb.WriteString("\r\n")
+	}
+
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:-//rutube//birthday bot//RU")
+	writeLine("CALSCALE:GREGORIAN")
+	writeLine("METHOD:PUBLISH")
+	writeLine("X-WR-CALNAME:Дни рождения коллег")
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, user := range users {
+		birthDate, err := time.Parse("2006-01-02", user.BirthDate)
+		if err != nil {
+			continue
+		}
+
+		// 29 February is celebrated on the last day of February in non-leap years.
+		rule := "RRULE:FREQ=YEARLY"
+		if birthDate.Month() == time.February && birthDate.Day() == 29 {
+			rule = "RRULE:FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+		}
+
+		writeLine("BEGIN:VEVENT")
+		writeLine(fmt.Sprintf("UID:birthday-%d@rutube", user.IDTG))
+		writeLine("DTSTAMP:" + stamp)
+		writeLine("DTSTART;VALUE=DATE:" + birthDate.Format("20060102"))
+		writeLine("DTEND;VALUE=DATE:" + birthDate.AddDate(0, 0, 1).Format("20060102"))
+		writeLine(rule)
+		writeLine("SUMMARY:" + escapeICSText(fmt.Sprintf("День рождения: %s %s", user.FirstName, user.LastName)))
+		writeLine("TRANSP:TRANSPARENT")
+		writeLine("END:VEVENT")
+	}
+
+	writeLine("END:VCALENDAR")
+	return []byte(sb.String())
+}
+
+func escapeICSText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	return replacer.Replace(strings.TrimSpace(text))
+}
+
+// foldICSLine splits lines longer than 75 octets as required by RFC 5545,
+// without breaking multi-byte characters.
+func foldICSLine(line string) string {
+	const limit = 75
+
+	var sb strings.Builder
+	size := 0
+	for _, r := range line {
+		runeSize := len(string(r))
+		if size+runeSize > limit {
+			sb.WriteString("\r\n ")
+			size = 1
+		}
+		sb.WriteRune(r)
+		size += runeSize
+	}
+	return sb.String()
+}
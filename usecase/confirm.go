@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pendingBirthdayTTL is how long a detected date waits for confirmation.
+const pendingBirthdayTTL = 24 * time.Hour
+
+const (
+	callbackBirthdayConfirm = "birthday:confirm"
+	callbackBirthdayEdit    = "birthday:edit"
+)
+
+// proposeBirthday keeps an automatically detected date aside and asks the user
+// whether it really is their birthday.
+func (uc *UseCase) proposeBirthday(ctx context.Context, id int, birthDate string, source string) error {
+	err := uc.db.SetPendingBirthday(ctx, models.PendingBirthday{TelegramID: id, BirthDate: birthDate, Source: source})
+	if err != nil {
+		return fmt.Errorf("error saving pending birthday: %w", err)
+	}
+
+	date, _ := time.Parse("2006-01-02", birthDate)
+	text := fmt.Sprintf("В вашем Био указана дата %s. Это ваш день рождения?", date.Format("02.01.2006"))
+	return uc.tg.SendButtons(ctx, int64(id), text, []models.Button{
+		{Text: "Да, сохранить", Data: callbackBirthdayConfirm + ":" + birthDate},
+		{Text: "Нет, ввести другую", Data: callbackBirthdayEdit},
+	})
+}
+
+// CallbackQuery handles a press on an inline button of the message messageID.
+func (uc *UseCase) CallbackQuery(ctx context.Context, callbackID string, id int, messageID int, data string) error {
+	defer uc.tg.AnswerCallback(ctx, callbackID, "")
+
+	if birthDate, ok := strings.CutPrefix(data, callbackBirthdayConfirm+":"); ok {
+		return uc.confirmBirthday(ctx, id, messageID, birthDate)
+	}
+	if action, ok := strings.CutPrefix(data, callbackSettings); ok {
+		return uc.settingsCallback(ctx, id, messageID, action)
+	}
+
+	switch data {
+	case callbackBirthdayEdit:
+		err := uc.db.DeletePendingBirthday(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error deleting pending birthday: %w", err)
+		}
+		return uc.replyTo(ctx, id, messageID, "Пожалуйста, введите вашу дату рождения в формате ДД-ММ-ГГГГ.")
+	default:
+		uc.Logger.Warn("Unknown callback data", zap.String("data", data))
+		return nil
+	}
+}
+
+func (uc *UseCase) confirmBirthday(ctx context.Context, id int, messageID int, birthDate string) error {
+	pending, ok, err := uc.db.TakePendingBirthday(ctx, id, birthDate, time.Now().Add(-pendingBirthdayTTL))
+	if err != nil {
+		return fmt.Errorf("error reading pending birthday: %w", err)
+	}
+	if !ok {
+		return uc.replyTo(ctx, id, messageID, "Срок подтверждения истёк. Пожалуйста, введите вашу дату рождения в формате ДД-ММ-ГГГГ.")
+	}
+
+	err = uc.db.UpdateUserBirthDate(ctx, id, pending.BirthDate, pending.Source)
+	if err != nil {
+		return fmt.Errorf("error updating birth date: %w", err)
+	}
+
+	date, _ := time.Parse("2006-01-02", pending.BirthDate)
+	text := fmt.Sprintf("Спасибо! Дата рождения %s сохранена.\n/biosync on - следить за изменениями даты в Био", date.Format("02.01.2006"))
+	return uc.replyTo(ctx, id, messageID, text)
+}
+
+// replyTo replaces the message with the buttons, or sends a new one when the
+// callback did not say which message it came from.
+func (uc *UseCase) replyTo(ctx context.Context, id int, messageID int, text string) error {
+	if messageID == 0 {
+		return uc.tg.Response(ctx, int64(id), text)
+	}
+	return uc.tg.EditMessage(ctx, int64(id), messageID, text)
+}
+
+// ExpirePendingBirthdays drops detected dates nobody confirmed in time.
+func (uc *UseCase) ExpirePendingBirthdays(ctx context.Context) error {
+	expired, err := uc.db.ExpirePendingBirthdays(ctx, time.Now().Add(-pendingBirthdayTTL))
+	if err != nil {
+		return fmt.Errorf("error expiring pending birthdays: %w", err)
+	}
+
+	if expired > 0 {
+		uc.Logger.Info("Unconfirmed birthdays expired", zap.Int64("count", expired))
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	digestWeekly  = "weekly"
+	digestMonthly = "monthly"
+)
+
+var (
+	weekdays        = [...]string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+	weekdaysEnglish = [...]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+)
+
+type occurrence struct {
+	event models.Event
+	date  time.Time
+	years int
+}
+
+// QueueDigests sends subscribers who chose digest delivery one message with
+// the events of everyone they follow: on Monday for the coming week, on the
+// first of the month for the whole month. Days and hours are the recipient's
+// local ones.
+func (uc *UseCase) QueueDigests(ctx context.Context, now time.Time) error {
+	prefs, err := uc.settingsByUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	users, err := uc.db.SetAllUser(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+
+	var recipients []models.Settings
+	for _, user := range users {
+		settings := prefs(int64(user.IDTG))
+		if user.IDTG != 0 && !user.Inactive && settings.Digest() {
+			recipients = append(recipients, settings)
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	events, err := uc.db.ListEvents(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("error listing events: %w", err)
+	}
+
+	subscriptions, err := uc.db.ListSubscriptions(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	people := make(map[int]models.ShortUserInfo)
+	for _, user := range users {
+		people[user.IDTG] = user
+	}
+
+	following := make(map[int64][]models.Subscription)
+	for _, sub := range subscriptions {
+		following[sub.SubscriberID] = append(following[sub.SubscriberID], sub)
+	}
+
+	var messages []models.OutboxMessage
+	for _, recipient := range recipients {
+		local := now.In(recipient.Location(uc.defaultLocation()))
+		if local.Hour() < recipient.NotifyHour {
+			continue
+		}
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+		var kinds []string
+		if recipient.DigestWeekly && today.Weekday() == time.Monday {
+			kinds = append(kinds, digestWeekly)
+		}
+		if recipient.DigestMonthly && today.Day() == 1 {
+			kinds = append(kinds, digestMonthly)
+		}
+
+		lang := recipient.Language
+		for _, kind := range kinds {
+			to := digestEnd(kind, today)
+			title := tr(lang, "Памятные даты на этой неделе:", "Coming up this week:")
+			if kind == digestMonthly {
+				title = tr(lang, "Памятные даты в этом месяце:", "Coming up this month:")
+			}
+
+			var found []occurrence
+			for _, sub := range following[recipient.TelegramID] {
+				for _, event := range events {
+					if int64(event.TelegramID) != sub.SubscribedToID || event.Visibility == models.VisibilityPrivate || !coversEvent(sub, event.Type) {
+						continue
+					}
+					found = append(found, occurrencesBetween(event, today, to)...)
+				}
+			}
+			if len(found) == 0 {
+				continue
+			}
+
+			messages = append(messages, models.OutboxMessage{
+				ChatID:   recipient.TelegramID,
+				Text:     title + "\n" + formatDigest(lang, found, people),
+				DedupKey: fmt.Sprintf("digest-%s:%d:%s", kind, recipient.TelegramID, today.Format("2006-01-02")),
+			})
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	queued, err := uc.db.EnqueueMessages(ctx, messages)
+	if err != nil {
+		return fmt.Errorf("error queueing digests: %w", err)
+	}
+
+	if queued > 0 {
+		uc.Logger.Info("Digests queued", zap.Int("count", queued))
+	}
+	return nil
+}
+
+// digestEnd returns the last day, inclusive, covered by a digest of kind sent
+// on today: the following Sunday for the weekly one, the last day of the month
+// for the monthly one.
+func digestEnd(kind string, today time.Time) time.Time {
+	if kind == digestMonthly {
+		return today.AddDate(0, 1, -1)
+	}
+	return today.AddDate(0, 0, 6)
+}
+
+func occurrencesBetween(event models.Event, from, to time.Time) []occurrence {
+	var result []occurrence
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		years, ok := eventOn(event, day)
+		if !ok || (event.Type == models.EventWorkAnniversary && years < 1) {
+			continue
+		}
+		result = append(result, occurrence{event: event, date: day, years: years})
+	}
+	return result
+}
+
+func formatDigest(lang string, found []occurrence, people map[int]models.ShortUserInfo) string {
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].date.Before(found[j].date)
+	})
+
+	var sb strings.Builder
+	for _, o := range found {
+		person := people[o.event.TelegramID]
+		what := eventLabelIn(lang, o.event.Type)
+		if o.event.Type == models.EventWorkAnniversary {
+			what = fmt.Sprintf("%s, %d %s", what, o.years, pluralYears(lang, o.years))
+		}
+		weekday := weekdays[o.date.Weekday()]
+		if lang == models.LanguageEnglish {
+			weekday = weekdaysEnglish[o.date.Weekday()]
+		}
+		name := strings.TrimSpace(person.FirstName + " " + person.LastName)
+		sb.WriteString(fmt.Sprintf("%s, %s — %s: %s\n", o.date.Format("02.01"), weekday, name, what))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
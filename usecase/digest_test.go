@@ -0,0 +1,67 @@
+package usecase
+
+import (
+	"testing"
+
+	"rutube/models"
+)
+
+func TestDigestEnd(t *testing.T) {
+	tests := []struct {
+		kind  string
+		today string
+		want  string
+	}{
+		{digestWeekly, "2030-05-06", "2030-05-12"},
+		{digestWeekly, "2030-12-30", "2031-01-05"},
+		{digestWeekly, "2028-02-28", "2028-03-05"},
+		{digestMonthly, "2030-05-01", "2030-05-31"},
+		{digestMonthly, "2030-02-01", "2030-02-28"},
+		{digestMonthly, "2028-02-01", "2028-02-29"},
+	}
+
+	for _, tt := range tests {
+		if got := digestEnd(tt.kind, day(tt.today)).Format("2006-01-02"); got != tt.want {
+			t.Errorf("digestEnd(%s, %s) = %s, want %s", tt.kind, tt.today, got, tt.want)
+		}
+	}
+}
+
+func TestOccurrencesBetweenWeek(t *testing.T) {
+	// The week of Monday 6 May 2030.
+	from := day("2030-05-06")
+	to := digestEnd(digestWeekly, from)
+
+	tests := []struct {
+		name  string
+		event models.Event
+		want  string
+		years int
+	}{
+		{"previous sunday", models.Event{Type: models.EventBirthday, Date: "1990-05-05"}, "", 0},
+		{"monday", models.Event{Type: models.EventBirthday, Date: "1990-05-06"}, "2030-05-06", 40},
+		{"sunday", models.Event{Type: models.EventBirthday, Date: "1990-05-12"}, "2030-05-12", 40},
+		{"next monday", models.Event{Type: models.EventBirthday, Date: "1990-05-13"}, "", 0},
+		{"one-off inside", models.Event{Type: models.EventNameDay, Date: "2030-05-08", Recurrence: models.RecurrenceOnce}, "2030-05-08", 0},
+		{"one-off last year", models.Event{Type: models.EventNameDay, Date: "2029-05-08", Recurrence: models.RecurrenceOnce}, "", 0},
+		{"first work anniversary", models.Event{Type: models.EventWorkAnniversary, Date: "2029-05-07"}, "2030-05-07", 1},
+		{"hire week", models.Event{Type: models.EventWorkAnniversary, Date: "2030-05-07"}, "", 0},
+	}
+
+	for _, tt := range tests {
+		found := occurrencesBetween(tt.event, from, to)
+		if tt.want == "" {
+			if len(found) != 0 {
+				t.Errorf("%s: got %s, want nothing", tt.name, found[0].date.Format("2006-01-02"))
+			}
+			continue
+		}
+		if len(found) != 1 {
+			t.Errorf("%s: got %d occurrences, want 1", tt.name, len(found))
+			continue
+		}
+		if got := found[0].date.Format("2006-01-02"); got != tt.want || found[0].years != tt.years {
+			t.Errorf("%s: got %s (%d years), want %s (%d years)", tt.name, got, found[0].years, tt.want, tt.years)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eventHelp = "Памятные даты:\n" +
+	"/event - ваши даты\n" +
+	"/event set <тип> <ДД-ММ-ГГГГ> [public|subscribers|private] - сохранить дату\n" +
+	"/event remove <тип> - удалить дату\n" +
+	"/event list <TelegramID> - даты коллеги\n" +
+	"Типы: birthday, anniversary, nameday"
+
+// eventAliases maps the short names users type to event types.
+var eventAliases = map[string]string{
+	"birthday":    models.EventBirthday,
+	"anniversary": models.EventWorkAnniversary,
+	"nameday":     models.EventNameDay,
+}
+
+var eventLabels = map[string]string{
+	models.EventBirthday:        "день рождения",
+	models.EventWorkAnniversary: "годовщина работы",
+	models.EventNameDay:         "именины",
+}
+
+var eventLabelsEnglish = map[string]string{
+	models.EventBirthday:        "birthday",
+	models.EventWorkAnniversary: "work anniversary",
+	models.EventNameDay:         "name day",
+}
+
+var visibilityLabels = map[string]string{
+	models.VisibilityPublic:      "видно всем",
+	models.VisibilitySubscribers: "видно подписчикам",
+	models.VisibilityPrivate:     "только для вас",
+}
+
+// parseEventType accepts both the short names from eventHelp and the stored
+// type names.
+func parseEventType(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if eventType, ok := eventAliases[name]; ok {
+		return eventType, true
+	}
+	if _, ok := eventLabels[name]; ok {
+		return name, true
+	}
+	return "", false
+}
+
+// Event handles /event. Private events are never announced, subscriber-only
+// ones are reminded about but left out of /allUser.
+func (uc *UseCase) Event(ctx context.Context, id int, param string) error {
+	fields := strings.Fields(param)
+	if len(fields) == 0 {
+		return uc.showEvents(ctx, id, int64(id))
+	}
+
+	switch {
+	case fields[0] == "list" && len(fields) == 1:
+		return uc.showEvents(ctx, id, int64(id))
+	case fields[0] == "list" && len(fields) == 2:
+		ownerID, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return uc.tg.Response(ctx, int64(id), eventHelp)
+		}
+		return uc.showEvents(ctx, id, ownerID)
+	case fields[0] == "set" && len(fields) >= 3:
+		return uc.setEvent(ctx, id, fields[1], fields[2], fields[3:])
+	case fields[0] == "remove" && len(fields) == 2:
+		return uc.removeEvent(ctx, id, fields[1])
+	default:
+		return uc.tg.Response(ctx, int64(id), eventHelp)
+	}
+}
+
+func (uc *UseCase) showEvents(ctx context.Context, id int, ownerID int64) error {
+	events, err := uc.db.ListEvents(ctx, int(ownerID))
+	if err != nil {
+		return fmt.Errorf("error listing events: %w", err)
+	}
+
+	own := ownerID == int64(id)
+	if !own {
+		subscribed, err := uc.db.IsSubscribed(ctx, int64(id), ownerID)
+		if err != nil {
+			return fmt.Errorf("error checking subscription: %w", err)
+		}
+		events = visibleEvents(events, subscribed)
+	}
+
+	if len(events) == 0 {
+		if own {
+			return uc.tg.Response(ctx, int64(id), "У вас нет сохранённых дат.\n\n"+eventHelp)
+		}
+		return uc.tg.Response(ctx, int64(id), "У коллеги нет дат, которые вам видны.")
+	}
+
+	var sb strings.Builder
+	for _, event := range events {
+		date, _ := time.Parse("2006-01-02", event.Date)
+		sb.WriteString(fmt.Sprintf("%s: %s", eventLabel(event.Type), date.Format("02.01.2006")))
+		if own {
+			sb.WriteString(fmt.Sprintf(" (%s)", visibilityLabels[event.Visibility]))
+		}
+		sb.WriteString("\n")
+	}
+	return uc.tg.Response(ctx, int64(id), strings.TrimSuffix(sb.String(), "\n"))
+}
+
+func (uc *UseCase) setEvent(ctx context.Context, id int, name string, dateParam string, options []string) error {
+	eventType, ok := parseEventType(name)
+	if !ok {
+		return uc.tg.Response(ctx, int64(id), eventHelp)
+	}
+
+	date, err := findAndFormatDate(dateParam)
+	if err != nil {
+		return uc.tg.Response(ctx, int64(id), "Пожалуйста, укажите дату в формате ДД-ММ-ГГГГ.")
+	}
+
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сначала отправьте /start")
+	}
+
+	event := models.Event{
+		TelegramID: id,
+		Type:       eventType,
+		Date:       date,
+		Recurrence: models.RecurrenceYearly,
+		Source:     models.BirthdaySourceManual,
+	}
+
+	settings, err := uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+	event.Visibility = uc.effectiveSettings(settings).Privacy
+
+	// Changing the date keeps the visibility chosen earlier.
+	events, err := uc.db.ListEvents(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error listing events: %w", err)
+	}
+	for _, existing := range events {
+		if existing.Type == eventType {
+			event.Visibility = existing.Visibility
+		}
+	}
+
+	for _, option := range options {
+		if _, ok := visibilityLabels[option]; ok {
+			event.Visibility = option
+			continue
+		}
+		return uc.tg.Response(ctx, int64(id), eventHelp)
+	}
+
+	err = uc.db.SetEvent(ctx, event)
+	if err != nil {
+		return fmt.Errorf("error saving event: %w", err)
+	}
+
+	if eventType == models.EventBirthday {
+		err = uc.db.DeletePendingBirthday(ctx, id)
+		if err != nil {
+			return fmt.Errorf("error deleting pending birthday: %w", err)
+		}
+	}
+
+	parsed, _ := time.Parse("2006-01-02", date)
+	text := fmt.Sprintf("Сохранено: %s %s (%s).", eventLabel(eventType), parsed.Format("02.01.2006"), visibilityLabels[event.Visibility])
+	return uc.tg.Response(ctx, int64(id), text)
+}
+
+func (uc *UseCase) removeEvent(ctx context.Context, id int, name string) error {
+	eventType, ok := parseEventType(name)
+	if !ok {
+		return uc.tg.Response(ctx, int64(id), eventHelp)
+	}
+
+	removed, err := uc.db.DeleteEvent(ctx, id, eventType)
+	if err != nil {
+		return fmt.Errorf("error deleting event: %w", err)
+	}
+	if !removed {
+		return uc.tg.Response(ctx, int64(id), "Такой даты у вас нет.")
+	}
+	return uc.tg.Response(ctx, int64(id), "Удалено.")
+}
+
+// visibleEvents drops the events another user may not see.
+func visibleEvents(events []models.Event, subscribed bool) []models.Event {
+	var result []models.Event
+	for _, event := range events {
+		switch event.Visibility {
+		case models.VisibilityPublic:
+		case models.VisibilitySubscribers:
+			if !subscribed {
+				continue
+			}
+		default:
+			continue
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+func eventLabel(eventType string) string {
+	if label, ok := eventLabels[eventType]; ok {
+		return label
+	}
+	return eventType
+}
+
+func eventLabelIn(lang string, eventType string) string {
+	if label, ok := eventLabelsEnglish[eventType]; ok && lang == models.LanguageEnglish {
+		return label
+	}
+	return eventLabel(eventType)
+}
+
+// eventOn reports whether the event falls on day and, for yearly events, how
+// many years have passed since its date.
+func eventOn(event models.Event, day time.Time) (years int, ok bool) {
+	date, err := time.Parse("2006-01-02", event.Date)
+	if err != nil {
+		return 0, false
+	}
+	if event.Recurrence == models.RecurrenceOnce {
+		return 0, date.Equal(day)
+	}
+	return day.Year() - date.Year(), birthdayInYear(date, day.Year()).Equal(day)
+}
+
+// coversEvent reports whether the subscription asks for events of this type.
+func coversEvent(sub models.Subscription, eventType string) bool {
+	if len(sub.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range sub.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
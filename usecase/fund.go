@@ -0,0 +1,358 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const maxPledge = 1000000
+
+const fundHelp = "Сбор на подарок:\n" +
+	"/fund - открытые сборы\n" +
+	"/fund open <TelegramID> - начать сбор для коллеги\n" +
+	"/fund pledge <номер> <сумма> - пообещать сумму\n" +
+	"/fund paid <номер> - отметить, что вы перевели деньги\n" +
+	"/fund summary <номер> - итоги сбора (для организатора)\n" +
+	"/fund close <номер> - закрыть сбор (для организатора)"
+
+// Fund handles /fund. Collections are visible to the organiser and to the
+// subscribers of the birthday person, never to the birthday person.
+func (uc *UseCase) Fund(ctx context.Context, id int, param string) error {
+	args := strings.Fields(param)
+	if len(args) == 0 {
+		return uc.listFunds(ctx, id)
+	}
+
+	if args[0] == "open" && len(args) == 2 {
+		birthdayID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return uc.tg.Response(ctx, int64(id), fundHelp)
+		}
+		return uc.openFund(ctx, id, birthdayID)
+	}
+
+	if len(args) < 2 {
+		return uc.tg.Response(ctx, int64(id), fundHelp)
+	}
+	fundID, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return uc.tg.Response(ctx, int64(id), fundHelp)
+	}
+	fund, err := uc.fundFor(ctx, id, fundID)
+	if err != nil {
+		return err
+	}
+	if fund.ID == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сбор не найден.")
+	}
+
+	switch {
+	case args[0] == "pledge" && len(args) == 3:
+		amount, err := strconv.Atoi(args[2])
+		if err != nil || amount <= 0 || amount > maxPledge {
+			return uc.tg.Response(ctx, int64(id), "Укажите сумму целым числом, например /fund pledge 3 500")
+		}
+		return uc.pledge(ctx, id, fund, amount)
+	case args[0] == "paid":
+		return uc.markPaid(ctx, id, fund)
+	case args[0] == "summary" && int64(id) == fund.OrganiserID:
+		text, err := uc.fundSummary(ctx, fund)
+		if err != nil {
+			return err
+		}
+		return uc.tg.Response(ctx, int64(id), text)
+	case args[0] == "close" && int64(id) == fund.OrganiserID:
+		return uc.closeFund(ctx, id, fund)
+	default:
+		return uc.tg.Response(ctx, int64(id), fundHelp)
+	}
+}
+
+// fundFor returns the fund if id may take part in it and a zero Fund
+// otherwise, so the birthday person cannot even learn that it exists.
+func (uc *UseCase) fundFor(ctx context.Context, id int, fundID int64) (models.Fund, error) {
+	fund, err := uc.db.GetFund(ctx, fundID)
+	if err != nil {
+		return models.Fund{}, fmt.Errorf("error finding fund: %w", err)
+	}
+	if fund.ID == 0 {
+		return models.Fund{}, nil
+	}
+
+	ok, err := uc.canJoinFund(ctx, int64(id), fund)
+	if err != nil || !ok {
+		return models.Fund{}, err
+	}
+	return fund, nil
+}
+
+func (uc *UseCase) canJoinFund(ctx context.Context, id int64, fund models.Fund) (bool, error) {
+	if id == fund.BirthdayID {
+		return false, nil
+	}
+	if id == fund.OrganiserID {
+		return true, nil
+	}
+
+	subscribed, err := uc.db.IsSubscribed(ctx, id, fund.BirthdayID)
+	if err != nil {
+		return false, fmt.Errorf("error checking subscription: %w", err)
+	}
+	return subscribed, nil
+}
+
+func (uc *UseCase) openFund(ctx context.Context, id int, birthdayID int64) error {
+	if birthdayID == int64(id) {
+		return uc.tg.Response(ctx, int64(id), "Нельзя собирать на подарок самому себе.")
+	}
+
+	subscribed, err := uc.db.IsSubscribed(ctx, int64(id), birthdayID)
+	if err != nil {
+		return fmt.Errorf("error checking subscription: %w", err)
+	}
+	if !subscribed {
+		return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Сначала подпишитесь на день рождения коллеги: /sub %d", birthdayID))
+	}
+
+	person, err := uc.db.FindUserByID(ctx, int(birthdayID))
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+
+	events, err := uc.db.ListEvents(ctx, int(birthdayID))
+	if err != nil {
+		return fmt.Errorf("error listing events: %w", err)
+	}
+
+	// A private birthday is not announced to anyone, so no fund is opened
+	// for it either: the invitation would reveal the date.
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	var next []occurrence
+	for _, event := range events {
+		if event.Type == models.EventBirthday && event.Visibility != models.VisibilityPrivate {
+			next = occurrencesBetween(event, today, today.AddDate(1, 0, -1))
+		}
+	}
+	if len(next) == 0 {
+		return uc.tg.Response(ctx, int64(id), "Дата рождения коллеги неизвестна или скрыта.")
+	}
+
+	fund, created, err := uc.db.OpenFund(ctx, birthdayID, int64(id), next[0].date.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("error opening fund: %w", err)
+	}
+	if fund.Closed {
+		return uc.tg.Response(ctx, int64(id), "Сбор к этому дню рождения уже закрыт.")
+	}
+	if !created {
+		return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Сбор уже открыт, номер %d.\n/fund pledge %d <сумма> - присоединиться", fund.ID, fund.ID))
+	}
+
+	uc.Logger.Info("Gift fund opened", zap.Int64("fund_id", fund.ID), zap.Int("organiser_id", id))
+
+	err = uc.announceFund(ctx, fund, person)
+	if err != nil {
+		return err
+	}
+
+	return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Сбор открыт, номер %d. Коллеги, подписанные на %s %s, получат приглашение.\n/fund summary %d - итоги",
+		fund.ID, person.FirstName, person.LastName, fund.ID))
+}
+
+// announceFund invites the other subscribers of the birthday person.
+func (uc *UseCase) announceFund(ctx context.Context, fund models.Fund, person models.ShortUserInfo) error {
+	subscriptions, err := uc.db.ListSubscriptions(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	organiser, err := uc.db.FindUserByID(ctx, int(fund.OrganiserID))
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+
+	date, _ := time.Parse("2006-01-02", fund.Date)
+	text := fmt.Sprintf("%s %s собирает деньги на подарок для %s %s (день рождения %s).\n/fund pledge %d <сумма> - присоединиться",
+		organiser.FirstName, organiser.LastName, person.FirstName, person.LastName, date.Format("02.01"), fund.ID)
+
+	var messages []models.OutboxMessage
+	for _, sub := range subscriptions {
+		if sub.SubscribedToID != fund.BirthdayID || sub.SubscriberID == fund.BirthdayID || sub.SubscriberID == fund.OrganiserID {
+			continue
+		}
+		messages = append(messages, models.OutboxMessage{
+			ChatID:   sub.SubscriberID,
+			Text:     text,
+			DedupKey: fmt.Sprintf("fund-open:%d:%d", fund.ID, sub.SubscriberID),
+		})
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+	_, err = uc.db.EnqueueMessages(ctx, messages)
+	if err != nil {
+		return fmt.Errorf("error queueing fund invitations: %w", err)
+	}
+	return nil
+}
+
+func (uc *UseCase) listFunds(ctx context.Context, id int) error {
+	funds, err := uc.db.ListOpenFunds(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing funds: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, fund := range funds {
+		ok, err := uc.canJoinFund(ctx, int64(id), fund)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		person, err := uc.db.FindUserByID(ctx, int(fund.BirthdayID))
+		if err != nil {
+			return fmt.Errorf("error finding user: %w", err)
+		}
+		date, _ := time.Parse("2006-01-02", fund.Date)
+		sb.WriteString(fmt.Sprintf("№%d: %s %s, %s\n", fund.ID, person.FirstName, person.LastName, date.Format("02.01")))
+	}
+
+	if sb.Len() == 0 {
+		return uc.tg.Response(ctx, int64(id), "Открытых сборов нет.\n\n"+fundHelp)
+	}
+	return uc.tg.Response(ctx, int64(id), sb.String()+"\n"+fundHelp)
+}
+
+func (uc *UseCase) pledge(ctx context.Context, id int, fund models.Fund, amount int) error {
+	if fund.Closed {
+		return uc.tg.Response(ctx, int64(id), "Сбор уже закрыт.")
+	}
+
+	err := uc.db.SetContribution(ctx, fund.ID, int64(id), amount)
+	if err != nil {
+		return fmt.Errorf("error saving pledge: %w", err)
+	}
+
+	return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Записали %d ₽. Когда переведёте деньги организатору, отправьте /fund paid %d", amount, fund.ID))
+}
+
+func (uc *UseCase) markPaid(ctx context.Context, id int, fund models.Fund) error {
+	if fund.Closed {
+		return uc.tg.Response(ctx, int64(id), "Сбор уже закрыт.")
+	}
+
+	ok, err := uc.db.MarkContributionPaid(ctx, fund.ID, int64(id))
+	if err != nil {
+		return fmt.Errorf("error marking pledge paid: %w", err)
+	}
+	if !ok {
+		return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Сначала укажите сумму: /fund pledge %d <сумма>", fund.ID))
+	}
+
+	return uc.tg.Response(ctx, int64(id), "Спасибо! Отметили оплату.")
+}
+
+func (uc *UseCase) closeFund(ctx context.Context, id int, fund models.Fund) error {
+	text, err := uc.fundSummary(ctx, fund)
+	if err != nil {
+		return err
+	}
+
+	err = uc.db.CloseFund(ctx, fund.ID)
+	if err != nil {
+		return fmt.Errorf("error closing fund: %w", err)
+	}
+
+	return uc.tg.Response(ctx, int64(id), "Сбор закрыт.\n\n"+text)
+}
+
+func (uc *UseCase) fundSummary(ctx context.Context, fund models.Fund) (string, error) {
+	person, err := uc.db.FindUserByID(ctx, int(fund.BirthdayID))
+	if err != nil {
+		return "", fmt.Errorf("error finding user: %w", err)
+	}
+
+	contributions, err := uc.db.ListContributions(ctx, fund.ID)
+	if err != nil {
+		return "", fmt.Errorf("error listing pledges: %w", err)
+	}
+
+	date, _ := time.Parse("2006-01-02", fund.Date)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Сбор №%d для %s %s (%s):\n", fund.ID, person.FirstName, person.LastName, date.Format("02.01")))
+
+	pledged, paid := 0, 0
+	for _, contribution := range contributions {
+		user, err := uc.db.FindUserByID(ctx, int(contribution.TelegramID))
+		if err != nil {
+			return "", fmt.Errorf("error finding user: %w", err)
+		}
+
+		mark := "⏳"
+		if contribution.Paid {
+			mark = "✅"
+			paid += contribution.Amount
+		}
+		pledged += contribution.Amount
+		sb.WriteString(fmt.Sprintf("%s %s %s - %d ₽\n", mark, user.FirstName, user.LastName, contribution.Amount))
+	}
+
+	if len(contributions) == 0 {
+		sb.WriteString("Пока никто не присоединился.\n")
+	}
+	sb.WriteString(fmt.Sprintf("Обещано: %d ₽, получено: %d ₽", pledged, paid))
+	return sb.String(), nil
+}
+
+// QueueFundSummaries sends the organiser the final summary of every fund whose
+// birthday has come and closes it.
+func (uc *UseCase) QueueFundSummaries(ctx context.Context, now time.Time) error {
+	if now.Hour() < uc.reminders.Hour {
+		return nil
+	}
+
+	funds, err := uc.db.ListOpenFunds(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing funds: %w", err)
+	}
+
+	today := now.Format("2006-01-02")
+	for _, fund := range funds {
+		if fund.Date > today {
+			continue
+		}
+
+		text, err := uc.fundSummary(ctx, fund)
+		if err != nil {
+			return err
+		}
+
+		_, err = uc.db.EnqueueMessages(ctx, []models.OutboxMessage{{
+			ChatID:   fund.OrganiserID,
+			Text:     "Сегодня день рождения, сбор закрыт.\n\n" + text,
+			DedupKey: fmt.Sprintf("fund-summary:%d", fund.ID),
+		}})
+		if err != nil {
+			return fmt.Errorf("error queueing fund summary: %w", err)
+		}
+
+		err = uc.db.CloseFund(ctx, fund.ID)
+		if err != nil {
+			return fmt.Errorf("error closing fund: %w", err)
+		}
+		uc.Logger.Info("Gift fund closed", zap.Int64("fund_id", fund.ID))
+	}
+
+	return nil
+}
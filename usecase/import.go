@@ -0,0 +1,210 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"rutube/infrastructure/spreadsheet"
+	"rutube/models"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const maxReportedRejections = 30
+
+var importColumnAliases = map[string]string{
+	"telegram_id":   "telegram_id",
+	"telegram id":   "telegram_id",
+	"username":      "username",
+	"логин":         "username",
+	"first_name":    "first_name",
+	"first name":    "first_name",
+	"имя":           "first_name",
+	"last_name":     "last_name",
+	"last name":     "last_name",
+	"фамилия":       "last_name",
+	"birth_date":    "birth_date",
+	"birthday":      "birth_date",
+	"дата рождения": "birth_date",
+}
+
+// ImportUsers expects the first row to be a header; columns are matched by name
+// (see importColumnAliases) and may come in any order.
+func (uc *UseCase) ImportUsers(ctx context.Context, rows [][]string) (models.ImportReport, error) {
+	report := models.ImportReport{Rejected: []models.RejectedRow{}}
+
+	if len(rows) == 0 {
+		return report, fmt.Errorf("%w: file is empty", ErrInvalidInput)
+	}
+
+	columns, err := importColumns(rows[0])
+	if err != nil {
+		return report, err
+	}
+
+	for i, row := range rows[1:] {
+		rowNumber := i + 2
+		if isEmptyRow(row) {
+			continue
+		}
+		report.Total++
+
+		user, err := parseImportRow(row, columns)
+		if err != nil {
+			report.Rejected = append(report.Rejected, models.RejectedRow{Row: rowNumber, Reason: err.Error()})
+			continue
+		}
+
+		created, err := uc.db.UpsertUser(ctx, user)
+		if err != nil {
+			uc.Logger.Error("Error while importing user", zap.Int("row", rowNumber), zap.Error(err))
+			report.Rejected = append(report.Rejected, models.RejectedRow{Row: rowNumber, Reason: err.Error()})
+			continue
+		}
+
+		if created {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+	}
+
+	err = uc.db.RecordAudit(ctx, models.AuditEntry{
+		Action: models.AuditImport,
+		NewValue: fmt.Sprintf("total: %d, created: %d, updated: %d, rejected: %d",
+			report.Total, report.Created, report.Updated, len(report.Rejected)),
+		Source: models.BirthdaySourceImport,
+	})
+	if err != nil {
+		return report, fmt.Errorf("error recording audit entry: %w", err)
+	}
+
+	return report, nil
+}
+
+func (uc *UseCase) ImportDocument(ctx context.Context, adminID int, fileID string, fileName string) error {
+	if !uc.isAdmin(adminID) {
+		uc.tg.Response(ctx, int64(adminID), "Загружать файлы могут только администраторы.")
+		return fmt.Errorf("user %d is not an admin", adminID)
+	}
+
+	data, err := uc.tg.DownloadFile(ctx, fileID)
+	if err != nil {
+		uc.tg.Response(ctx, int64(adminID), "Не удалось скачать файл.")
+		return fmt.Errorf("error downloading file: %w", err)
+	}
+
+	rows, err := spreadsheet.ReadRows(fileName, bytes.NewReader(data))
+	if err != nil {
+		uc.tg.Response(ctx, int64(adminID), "Не удалось прочитать файл: "+err.Error())
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	report, err := uc.ImportUsers(ctx, rows)
+	if err != nil {
+		uc.tg.Response(ctx, int64(adminID), "Импорт не выполнен: "+err.Error())
+		return err
+	}
+
+	return uc.tg.Response(ctx, int64(adminID), FormatImportReport(report))
+}
+
+func FormatImportReport(report models.ImportReport) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("Импорт завершён. Строк: %d, добавлено: %d, обновлено: %d, отклонено: %d\n",
+		report.Total, report.Created, report.Updated, len(report.Rejected)))
+
+	for i, rejected := range report.Rejected {
+		if i == maxReportedRejections {
+			sb.WriteString(fmt.Sprintf("... и ещё %d\n", len(report.Rejected)-maxReportedRejections))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("Строка %d: %s\n", rejected.Row, rejected.Reason))
+	}
+
+	return sb.String()
+}
+
+// importColumns maps the header cells to column indexes. Two cells naming the
+// same column, e.g. "birthday" and "дата рождения", are rejected rather than
+// letting one of them silently win.
+func importColumns(header []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		column, ok := importColumnAliases[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+		if first, ok := columns[column]; ok {
+			return nil, fmt.Errorf("%w: header columns %q and %q both map to %s",
+				ErrInvalidInput, strings.TrimSpace(header[first]), strings.TrimSpace(name), column)
+		}
+		columns[column] = i
+	}
+
+	if _, ok := columns["birth_date"]; !ok {
+		return nil, fmt.Errorf("%w: header must contain a birth_date column", ErrInvalidInput)
+	}
+	_, hasID := columns["telegram_id"]
+	_, hasUsername := columns["username"]
+	if !hasID && !hasUsername {
+		return nil, fmt.Errorf("%w: header must contain a telegram_id or username column", ErrInvalidInput)
+	}
+	return columns, nil
+}
+
+func parseImportRow(row []string, columns map[string]int) (models.ShortUserInfo, error) {
+	cell := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var user models.ShortUserInfo
+
+	if value := cell("telegram_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return user, fmt.Errorf("invalid telegram_id %q", value)
+		}
+		user.IDTG = id
+	}
+
+	user.Username = normalizeUsername(cell("username"))
+	if user.IDTG == 0 && user.Username == "" {
+		return user, fmt.Errorf("telegram_id or username is required")
+	}
+
+	birthDate, err := findAndFormatDate(cell("birth_date"))
+	if err != nil {
+		return user, fmt.Errorf("invalid birth_date %q", cell("birth_date"))
+	}
+	user.BirthDate = birthDate
+	user.BirthdaySource = models.BirthdaySourceImport
+	user.FirstName = cell("first_name")
+	user.LastName = cell("last_name")
+
+	return user, nil
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+func isEmptyRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (uc *UseCase) isAdmin(telegramID int) bool {
+	return uc.admins[int64(telegramID)]
+}
@@ -0,0 +1,220 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"rutube/infrastructure/database"
+	"rutube/infrastructure/spreadsheet"
+	"rutube/models"
+
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+func TestImportColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:   "canonical",
+			header: []string{"telegram_id", "username", "first_name", "last_name", "birth_date"},
+			want:   map[string]int{"telegram_id": 0, "username": 1, "first_name": 2, "last_name": 3, "birth_date": 4},
+		},
+		{
+			name:   "russian aliases in any order",
+			header: []string{"Дата рождения", " Фамилия ", "Имя", "Логин"},
+			want:   map[string]int{"birth_date": 0, "last_name": 1, "first_name": 2, "username": 3},
+		},
+		{
+			name:   "unknown columns are ignored",
+			header: []string{"Telegram ID", "Отдел", "Birthday"},
+			want:   map[string]int{"telegram_id": 0, "birth_date": 2},
+		},
+		{
+			name:    "duplicate alias",
+			header:  []string{"username", "birthday", "дата рождения"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate column name",
+			header:  []string{"username", "birth_date", "Birth_Date"},
+			wantErr: true,
+		},
+		{
+			name:    "no birth_date",
+			header:  []string{"telegram_id", "username"},
+			wantErr: true,
+		},
+		{
+			name:    "no telegram_id or username",
+			header:  []string{"first_name", "birth_date"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		columns, err := importColumns(tt.header)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("%s: got %v, want ErrInvalidInput", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(columns, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, columns, tt.want)
+		}
+	}
+}
+
+func TestParseImportRow(t *testing.T) {
+	columns := map[string]int{"telegram_id": 0, "username": 1, "first_name": 2, "birth_date": 3}
+
+	tests := []struct {
+		name    string
+		row     []string
+		want    models.ShortUserInfo
+		wantErr bool
+	}{
+		{
+			name: "full row",
+			row:  []string{"42", "@Ivan", "Иван", "10-05-1990"},
+			want: models.ShortUserInfo{IDTG: 42, Username: "ivan", FirstName: "Иван", BirthDate: "1990-05-10", BirthdaySource: models.BirthdaySourceImport},
+		},
+		{
+			name: "username only, short row",
+			row:  []string{"", "petr", "", "1985/12/31"},
+			want: models.ShortUserInfo{Username: "petr", BirthDate: "1985-12-31", BirthdaySource: models.BirthdaySourceImport},
+		},
+		{name: "non-numeric telegram_id", row: []string{"abc", "ivan", "", "10-05-1990"}, wantErr: true},
+		{name: "negative telegram_id", row: []string{"-5", "ivan", "", "10-05-1990"}, wantErr: true},
+		{name: "no telegram_id or username", row: []string{"", " @ ", "Иван", "10-05-1990"}, wantErr: true},
+		{name: "no birth_date", row: []string{"42", "ivan", "Иван"}, wantErr: true},
+		{name: "impossible birth_date", row: []string{"42", "ivan", "", "31-02-1990"}, wantErr: true},
+		{name: "garbage birth_date", row: []string{"42", "ivan", "", "скоро"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		user, err := parseImportRow(tt.row, columns)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: accepted as %+v", tt.name, user)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if user != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, user, tt.want)
+		}
+	}
+}
+
+func testUseCase(t *testing.T) *UseCase {
+	t.Helper()
+
+	conn, err := database.InitDatabase("sqlite3", filepath.Join(t.TempDir(), "test.db"), database.Options{})
+	if err != nil {
+		t.Fatalf("InitDatabase: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewUseCase(zap.NewNop(), database.NewDatabase(zap.NewNop(), conn), nil, Options{})
+}
+
+func importXLSX(t *testing.T) []byte {
+	t.Helper()
+
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	rows := [][]interface{}{
+		{"Логин", "Имя", "Дата рождения"},
+		{"@Ivan", "Иван", time.Date(1990, time.May, 10, 0, 0, 0, 0, time.UTC)},
+		{"petr", "Пётр", "31/12/1985"},
+		{},
+		{"anna", "Анна", "31-02-1990"},
+	}
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := file.SetSheetRow(sheet, cell, &row); err != nil {
+			t.Fatalf("SetSheetRow: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := file.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestImportRoundTrip feeds the same people as CSV and as XLSX through
+// spreadsheet.ReadRows into ImportUsers and checks what ends up stored.
+func TestImportRoundTrip(t *testing.T) {
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"users.csv", []byte("\xef\xbb\xbfЛогин;Имя;Дата рождения\n@Ivan;Иван;10-05-1990\npetr;Пётр;31/12/1985\n;;\nanna;Анна;31-02-1990\n")},
+		{"users.xlsx", importXLSX(t)},
+	}
+
+	for _, file := range files {
+		uc := testUseCase(t)
+		ctx := context.Background()
+
+		rows, err := spreadsheet.ReadRows(file.name, bytes.NewReader(file.data))
+		if err != nil {
+			t.Fatalf("%s: ReadRows: %v", file.name, err)
+		}
+
+		report, err := uc.ImportUsers(ctx, rows)
+		if err != nil {
+			t.Fatalf("%s: ImportUsers: %v", file.name, err)
+		}
+		want := models.ImportReport{Total: 3, Created: 2, Rejected: []models.RejectedRow{{Row: 5, Reason: `invalid birth_date "31-02-1990"`}}}
+		if !reflect.DeepEqual(report, want) {
+			t.Errorf("%s: report %+v, want %+v", file.name, report, want)
+		}
+
+		// Importing the same file again updates instead of duplicating.
+		report, err = uc.ImportUsers(ctx, rows)
+		if err != nil {
+			t.Fatalf("%s: second ImportUsers: %v", file.name, err)
+		}
+		if report.Created != 0 || report.Updated != 2 {
+			t.Errorf("%s: second import created %d, updated %d", file.name, report.Created, report.Updated)
+		}
+
+		users, err := uc.db.SetAllUser(ctx)
+		if err != nil {
+			t.Fatalf("%s: SetAllUser: %v", file.name, err)
+		}
+		got := map[string]string{}
+		for _, user := range users {
+			got[user.Username] = user.FirstName + " " + user.BirthDate
+		}
+		wantUsers := map[string]string{"ivan": "Иван 1990-05-10", "petr": "Пётр 1985-12-31"}
+		if !reflect.DeepEqual(got, wantUsers) {
+			t.Errorf("%s: stored %v, want %v", file.name, got, wantUsers)
+		}
+	}
+}
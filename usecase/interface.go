@@ -1,8 +1,43 @@
 package usecase
 
+import (
+	"context"
+	"rutube/models"
+	"time"
+)
+
 type UseCaseInterface interface {
-	StartCase(firstName string, lastname string, id int) error
-	SetBirthday(date string, id int) error
-	SetAllUser(id int) error
-	SetSub(id int, idSub string) error
+	StartCase(ctx context.Context, firstName string, lastname string, username string, id int) error
+	SetBirthday(ctx context.Context, date string, id int) error
+	SetAllUser(ctx context.Context, id int) error
+	SetSub(ctx context.Context, id int, idSub string) error
+	ImportDocument(ctx context.Context, adminID int, fileID string, fileName string) error
+	SendCalendar(ctx context.Context, id int, param string) error
+	CalendarFeed(ctx context.Context, token string) ([]byte, error)
+	BackupCase(ctx context.Context, id int) error
+	ForgetMe(ctx context.Context, id int, param string) error
+	MyData(ctx context.Context, id int) error
+	ChatMemberUpdated(ctx context.Context, id int, status string) error
+	BioSync(ctx context.Context, id int, param string) error
+	Fund(ctx context.Context, id int, param string) error
+	Wishlist(ctx context.Context, id int, param string) error
+	Event(ctx context.Context, id int, param string) error
+	Settings(ctx context.Context, id int, param string) error
+	Vacation(ctx context.Context, id int, param string) error
+	Audit(ctx context.Context, id int, param string) error
+	CallbackQuery(ctx context.Context, callbackID string, id int, messageID int, data string) error
+}
+
+type AdminUseCaseInterface interface {
+	ListUsers(ctx context.Context) ([]models.ShortUserInfo, error)
+	GetUser(ctx context.Context, telegramID int) (models.ShortUserInfo, error)
+	GetUserByUsername(ctx context.Context, username string) (models.ShortUserInfo, error)
+	CreateUser(ctx context.Context, user models.ShortUserInfo) (models.ShortUserInfo, error)
+	UpdateUser(ctx context.Context, telegramID int, patch models.UserPatch) (models.ShortUserInfo, error)
+	DeleteUser(ctx context.Context, telegramID int) error
+	ListSubscriptions(ctx context.Context, subscriberID int64) ([]models.Subscription, error)
+	CreateSubscription(ctx context.Context, subscriberID, subscribedToID int64) error
+	DeleteSubscription(ctx context.Context, subscriberID, subscribedToID int64) error
+	UpcomingBirthdays(ctx context.Context, from, to time.Time) ([]models.UpcomingBirthday, error)
+	AuditLog(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
 }
@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"rutube/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const forgetConfirmationTTL = 5 * time.Minute
+
+func (uc *UseCase) ForgetMe(ctx context.Context, id int, param string) error {
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "О вас нет сохранённых данных.")
+	}
+
+	if param != "confirm" {
+		uc.forgetMu.Lock()
+		uc.forgetRequests[id] = time.Now()
+		uc.forgetMu.Unlock()
+
+		text := "Будут удалены ваш профиль, дата рождения и все подписки — ваши и на вас. Отменить это будет нельзя.\n" +
+			"В журнале изменений для администраторов останутся только отметки о действиях без ваших данных.\n" +
+			"Чтобы подтвердить, в течение 5 минут отправьте /forgetme confirm"
+		return uc.tg.Response(ctx, int64(id), text)
+	}
+
+	uc.forgetMu.Lock()
+	requestedAt, ok := uc.forgetRequests[id]
+	delete(uc.forgetRequests, id)
+	uc.forgetMu.Unlock()
+
+	if !ok || time.Since(requestedAt) > forgetConfirmationTTL {
+		return uc.tg.Response(ctx, int64(id), "Запрос на удаление не найден или устарел. Отправьте /forgetme ещё раз.")
+	}
+
+	err = uc.db.DeleteUser(ctx, id)
+	if err != nil {
+		uc.tg.Response(ctx, int64(id), "Не удалось удалить данные, попробуйте позже.")
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	uc.Logger.Info("User data deleted on request", zap.Int("telegram_id", id))
+	return uc.tg.Response(ctx, int64(id), "Все ваши данные удалены. Чтобы снова пользоваться ботом, отправьте /start")
+}
+
+func (uc *UseCase) MyData(ctx context.Context, id int) error {
+	data, err := uc.PersonalData(ctx, id)
+	if err != nil {
+		return err
+	}
+	if data.User.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "О вас нет сохранённых данных.")
+	}
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding personal data: %w", err)
+	}
+
+	return uc.tg.SendDocument(ctx, int64(id), "mydata.json", content, "Все данные, которые бот хранит о вас")
+}
+
+func (uc *UseCase) PersonalData(ctx context.Context, id int) (models.PersonalData, error) {
+	data := models.PersonalData{
+		ExportedAt:   time.Now().UTC().Format(time.RFC3339),
+		SubscribedTo: []models.Subscription{},
+		Subscribers:  []models.Subscription{},
+		Wishlist:     []models.WishlistItem{},
+		Events:       []models.Event{},
+		AuditLog:     []models.AuditEntry{},
+	}
+
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return data, fmt.Errorf("error finding user: %w", err)
+	}
+	data.User = user
+	if user.IDTG == 0 {
+		return data, nil
+	}
+
+	subscriptions, err := uc.db.ListUserSubscriptions(ctx, int64(id))
+	if err != nil {
+		return data, fmt.Errorf("error listing subscriptions: %w", err)
+	}
+	for _, sub := range subscriptions {
+		if sub.SubscriberID == int64(id) {
+			data.SubscribedTo = append(data.SubscribedTo, sub)
+		} else {
+			data.Subscribers = append(data.Subscribers, sub)
+		}
+	}
+
+	token, err := uc.db.GetCalendarToken(ctx, id)
+	if err != nil {
+		return data, fmt.Errorf("error reading calendar token: %w", err)
+	}
+	data.CalendarFeedEnabled = token != ""
+
+	wishlist, err := uc.db.ListWishlist(ctx, int64(id))
+	if err != nil {
+		return data, fmt.Errorf("error listing wishlist: %w", err)
+	}
+	if wishlist != nil {
+		data.Wishlist = wishlist
+	}
+
+	events, err := uc.db.ListEvents(ctx, id)
+	if err != nil {
+		return data, fmt.Errorf("error listing events: %w", err)
+	}
+	if events != nil {
+		data.Events = events
+	}
+
+	entries, err := uc.db.ListAudit(ctx, models.AuditFilter{TelegramID: int64(id)})
+	if err != nil {
+		return data, fmt.Errorf("error listing audit log: %w", err)
+	}
+	if entries != nil {
+		data.AuditLog = entries
+	}
+
+	data.Settings, err = uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return data, fmt.Errorf("error reading settings: %w", err)
+	}
+
+	return data, nil
+}
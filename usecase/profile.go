@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"go.uber.org/zap"
+)
+
+// profileSyncPause spaces out getChat calls so the sync never competes with
+// interactive traffic for the Telegram rate limit.
+const profileSyncPause = 200 * time.Millisecond
+
+func (uc *UseCase) BioSync(ctx context.Context, id int, param string) error {
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сначала отправьте /start")
+	}
+
+	var enabled bool
+	switch param {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		state := "выключено"
+		if user.BioSync {
+			state = "включено"
+		}
+		text := fmt.Sprintf("Слежение за датой рождения в Био %s.\n/biosync on - включить\n/biosync off - выключить", state)
+		return uc.tg.Response(ctx, int64(id), text)
+	}
+
+	err = uc.db.SetBioSync(ctx, id, enabled)
+	if err != nil {
+		return fmt.Errorf("error updating bio sync: %w", err)
+	}
+
+	if enabled {
+		return uc.tg.Response(ctx, int64(id), "Готово. Раз в день бот будет проверять дату рождения в вашем Био. Дату, которую вы ввели сами, он без вашего подтверждения не заменит.")
+	}
+	return uc.tg.Response(ctx, int64(id), "Готово. Бот больше не будет читать ваше Био.")
+}
+
+// SyncProfiles refreshes names and usernames of active users from Telegram
+// and, for users who opted in with /biosync, re-reads the birthday from their
+// Bio.
+func (uc *UseCase) SyncProfiles(ctx context.Context) error {
+	users, err := uc.db.SetAllUser(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+
+	synced, failed := 0, 0
+	for _, user := range users {
+		if user.IDTG == 0 || user.Inactive {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(profileSyncPause):
+		}
+
+		chat, err := uc.tg.GetUserInfo(ctx, int64(user.IDTG))
+		if err != nil {
+			failed++
+			continue
+		}
+
+		err = uc.syncProfile(ctx, user, chat)
+		if err != nil {
+			uc.Logger.Error("Error while syncing profile", zap.Int("telegram_id", user.IDTG), zap.Error(err))
+			failed++
+			continue
+		}
+		synced++
+	}
+
+	uc.Logger.Info("Profiles synced", zap.Int("synced", synced), zap.Int("failed", failed))
+	return nil
+}
+
+func (uc *UseCase) syncProfile(ctx context.Context, user models.ShortUserInfo, chat *tgbotapi.Chat) error {
+	if chat.FirstName != user.FirstName || chat.LastName != user.LastName || normalizeUsername(chat.UserName) != user.Username {
+		err := uc.db.UpdateProfile(ctx, user.IDTG, chat.FirstName, chat.LastName, normalizeUsername(chat.UserName))
+		if err != nil {
+			return fmt.Errorf("error updating profile: %w", err)
+		}
+	}
+
+	if !user.BioSync {
+		return nil
+	}
+
+	birthDate, err := findAndFormatDate(chat.Bio)
+	if err != nil || birthDate == user.BirthDate {
+		return nil
+	}
+
+	// Only a date that itself came from the Bio is replaced; anything entered
+	// by the user, an admin or an import needs the user's confirmation.
+	if user.BirthDate == "" || user.BirthdaySource == models.BirthdaySourceBio {
+		err = uc.db.UpdateUserBirthDate(ctx, user.IDTG, birthDate, models.BirthdaySourceBio)
+		if err != nil {
+			return fmt.Errorf("error updating birth date: %w", err)
+		}
+		uc.Logger.Info("Birth date updated from bio", zap.Int("telegram_id", user.IDTG))
+		return nil
+	}
+
+	date, _ := time.Parse("2006-01-02", birthDate)
+	current, _ := time.Parse("2006-01-02", user.BirthDate)
+	text := fmt.Sprintf("В вашем Био указана дата рождения %s, а у бота сохранена %s. Если верна дата из Био, отправьте её в формате ДД-ММ-ГГГГ.",
+		date.Format("02.01.2006"), current.Format("02.01.2006"))
+
+	_, err = uc.db.EnqueueMessages(ctx, []models.OutboxMessage{{
+		ChatID:   int64(user.IDTG),
+		Text:     text,
+		DedupKey: fmt.Sprintf("bio-conflict:%d:%s", user.IDTG, birthDate),
+	}})
+	if err != nil {
+		return fmt.Errorf("error queueing bio conflict message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/infrastructure/workcalendar"
+	"rutube/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// QueueReminders puts a message into the outbox for every active subscriber of
+// a colleague who has an event today or in one of the subscriber's reminder
+// offsets, once the subscriber's notify hour has come in their time zone.
+// Subscribers who chose a digest get QueueDigests instead. Private events are
+// skipped, and events on days off may be announced on a working day instead,
+// see ReminderOptions.Calendar. The job runs many times a day; dedup keys make
+// repeated runs no-ops.
+func (uc *UseCase) QueueReminders(ctx context.Context, now time.Time) error {
+	users, err := uc.db.SetAllUser(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+
+	events, err := uc.db.ListEvents(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("error listing events: %w", err)
+	}
+
+	subscriptions, err := uc.db.ListSubscriptions(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	prefs, err := uc.settingsByUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	people := make(map[int]models.ShortUserInfo)
+	for _, user := range users {
+		people[user.IDTG] = user
+	}
+
+	personEvents := make(map[int64][]models.Event)
+	for _, event := range events {
+		if event.Visibility == models.VisibilityPrivate || event.TelegramID == 0 {
+			continue
+		}
+		personEvents[int64(event.TelegramID)] = append(personEvents[int64(event.TelegramID)], event)
+	}
+
+	hints := make(map[string]string)
+
+	var messages []models.OutboxMessage
+	for _, sub := range subscriptions {
+		settings := prefs(sub.SubscriberID)
+		if people[int(sub.SubscriberID)].Inactive || settings.Digest() {
+			continue
+		}
+
+		local := now.In(settings.Location(uc.defaultLocation()))
+		if local.Hour() < settings.NotifyHour {
+			continue
+		}
+		today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+		person := people[int(sub.SubscribedToID)]
+		for _, offset := range append([]int{0}, settings.ReminderOffsets...) {
+			day := today.AddDate(0, 0, offset)
+			for _, event := range personEvents[sub.SubscribedToID] {
+				if !coversEvent(sub, event.Type) {
+					continue
+				}
+				eventDay, years, ok := uc.occurrenceAnnouncedOn(event, person.Team, day, offset > 0)
+				if !ok || (event.Type == models.EventWorkAnniversary && years < 1) {
+					continue
+				}
+
+				lang := settings.Language
+				daysBefore := int(eventDay.Sub(today).Hours() / 24)
+				date := eventDay.Format("2006-01-02")
+				var text string
+				if offset == 0 && daysBefore != 0 {
+					text = shiftedReminderText(lang, person, event.Type, date, years)
+				} else {
+					text = eventReminderText(lang, person, event.Type, date, years, daysBefore)
+				}
+
+				// Gift hints go only into the advance birthday reminder, when
+				// there is still time to buy something.
+				if offset > 0 && event.Type == models.EventBirthday && sub.SubscriberID != int64(person.IDTG) {
+					key := fmt.Sprintf("%d:%s", person.IDTG, lang)
+					if _, ok := hints[key]; !ok {
+						hints[key], err = uc.giftHints(ctx, lang, person)
+						if err != nil {
+							return err
+						}
+					}
+					text += hints[key]
+				}
+
+				messages = append(messages, models.OutboxMessage{
+					ChatID:   sub.SubscriberID,
+					Text:     text,
+					DedupKey: fmt.Sprintf("%s:%d:%d:%s:%d", event.Type, person.IDTG, sub.SubscriberID, date, offset),
+				})
+			}
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	queued, err := uc.db.EnqueueMessages(ctx, messages)
+	if err != nil {
+		return fmt.Errorf("error queueing reminders: %w", err)
+	}
+
+	if queued > 0 {
+		uc.Logger.Info("Event reminders queued", zap.Int("count", queued))
+	}
+	return nil
+}
+
+// settingsByUser loads all stored settings at once for the scheduler; the
+// returned func gives effective settings, defaults included, for any user.
+func (uc *UseCase) settingsByUser(ctx context.Context) (func(telegramID int64) models.Settings, error) {
+	list, err := uc.db.ListSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing settings: %w", err)
+	}
+
+	stored := make(map[int64]models.Settings, len(list))
+	for _, settings := range list {
+		stored[settings.TelegramID] = settings
+	}
+
+	return func(telegramID int64) models.Settings {
+		settings, ok := stored[telegramID]
+		if !ok {
+			settings = models.DefaultSettings(telegramID)
+		}
+		return uc.effectiveSettings(settings)
+	}, nil
+}
+
+func (uc *UseCase) giftHints(ctx context.Context, lang string, person models.ShortUserInfo) (string, error) {
+	items, err := uc.db.ListWishlist(ctx, int64(person.IDTG))
+	if err != nil {
+		return "", fmt.Errorf("error listing wishlist: %w", err)
+	}
+
+	var hints string
+	if len(items) > 0 {
+		hints += tr(lang, "\n\nСписок желаний:\n", "\n\nWishlist:\n") + formatWishlist(items)
+	}
+	hints += fmt.Sprintf(tr(lang, "\n\nСобрать деньги на подарок: /fund open %d", "\n\nChip in for a gift: /fund open %d"), person.IDTG)
+	return hints, nil
+}
+
+// occurrenceAnnouncedOn finds the date of the event whose on-the-day
+// announcement, after the calendar policy of the team, falls on day. For an
+// advance reminder day is counted from the event itself when the announcement
+// moves past it.
+func (uc *UseCase) occurrenceAnnouncedOn(event models.Event, team string, day time.Time, advance bool) (time.Time, int, bool) {
+	policy := uc.reminders.DefaultPolicy
+	if teamPolicy, ok := uc.reminders.TeamPolicies[team]; ok && team != "" {
+		policy = teamPolicy
+	}
+	if uc.reminders.Calendar == nil || policy == "" || policy == workcalendar.PolicyNone {
+		years, ok := eventOn(event, day)
+		return day, years, ok
+	}
+
+	for shift := -workcalendar.MaxShift; shift <= workcalendar.MaxShift; shift++ {
+		candidate := day.AddDate(0, 0, shift)
+		years, ok := eventOn(event, candidate)
+		if !ok {
+			continue
+		}
+		announced := uc.reminders.Calendar.Shift(candidate, policy)
+		if advance && candidate.Before(announced) {
+			announced = candidate
+		}
+		if announced.Equal(day) {
+			return candidate, years, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// shiftedReminderText announces an event that falls on a day off on the
+// working day chosen by the calendar policy.
+func shiftedReminderText(lang string, user models.ShortUserInfo, eventType string, date string, years int) string {
+	name := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+	day, _ := time.Parse("2006-01-02", date)
+	what := eventLabelIn(lang, eventType)
+	if eventType == models.EventWorkAnniversary {
+		what = fmt.Sprintf("%s (%d %s)", what, years, pluralYears(lang, years))
+	}
+	return fmt.Sprintf(tr(lang,
+		"🎉 %s выпадает на выходной, поэтому поздравляем сегодня: %s у %s!",
+		"🎉 %s falls on a day off, so we celebrate today: %s of %s!"),
+		day.Format("02.01"), what, name)
+}
+
+func eventReminderText(lang string, user models.ShortUserInfo, eventType string, date string, years int, daysBefore int) string {
+	name := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+	day, _ := time.Parse("2006-01-02", date)
+	switch eventType {
+	case models.EventBirthday:
+		return reminderText(lang, models.UpcomingBirthday{User: user, Date: date, Age: years}, daysBefore)
+	case models.EventWorkAnniversary:
+		if daysBefore == 0 {
+			return fmt.Sprintf(tr(lang,
+				"🎉 Сегодня у %s годовщина работы в компании: %d %s!",
+				"🎉 Today %s celebrates %d %s with the company!"),
+				name, years, pluralYears(lang, years))
+		}
+		return fmt.Sprintf(tr(lang,
+			"Через %d %s, %s, у %s годовщина работы: %d %s.",
+			"In %d %s, on %s, %s celebrates %d %s with the company."),
+			daysBefore, pluralDays(lang, daysBefore), day.Format("02.01"), name, years, pluralYears(lang, years))
+	default:
+		if daysBefore == 0 {
+			return fmt.Sprintf(tr(lang, "🎉 Сегодня у %s %s!", "🎉 Today is the %[2]s of %[1]s!"), name, eventLabelIn(lang, eventType))
+		}
+		return fmt.Sprintf(tr(lang, "Через %d %s, %s, у %s %s.", "In %d %s, on %s, it is the %[5]s of %[4]s."),
+			daysBefore, pluralDays(lang, daysBefore), day.Format("02.01"), name, eventLabelIn(lang, eventType))
+	}
+}
+
+func reminderText(lang string, birthday models.UpcomingBirthday, daysBefore int) string {
+	name := fmt.Sprintf("%s %s", birthday.User.FirstName, birthday.User.LastName)
+	if daysBefore == 0 {
+		return fmt.Sprintf(tr(lang,
+			"🎉 Сегодня день рождения у %s! Не забудьте поздравить.",
+			"🎉 Today is the birthday of %s! Don't forget to congratulate them."), name)
+	}
+
+	date, _ := time.Parse("2006-01-02", birthday.Date)
+	return fmt.Sprintf(tr(lang, "Через %d %s, %s, день рождения у %s.", "In %d %s, on %s, it is the birthday of %s."),
+		daysBefore, pluralDays(lang, daysBefore), date.Format("02.01"), name)
+}
+
+func pluralDays(lang string, n int) string {
+	if lang == models.LanguageEnglish {
+		if n == 1 {
+			return "day"
+		}
+		return "days"
+	}
+
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 10 || n%100 >= 20):
+		return "дня"
+	default:
+		return "дней"
+	}
+}
+
+func pluralYears(lang string, n int) string {
+	if lang == models.LanguageEnglish {
+		if n == 1 {
+			return "year"
+		}
+		return "years"
+	}
+
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "год"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 10 || n%100 >= 20):
+		return "года"
+	default:
+		return "лет"
+	}
+}
@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rutube/infrastructure/workcalendar"
+	"rutube/models"
+)
+
+func day(value string) time.Time {
+	d, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func testCalendar(t *testing.T) *workcalendar.Calendar {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "calendar.json")
+	data := `{"holidays": ["2030-05-09", "2030-05-10"]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := workcalendar.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return calendar
+}
+
+func TestOccurrenceAnnouncedOn(t *testing.T) {
+	uc := &UseCase{reminders: ReminderOptions{
+		Calendar:      testCalendar(t),
+		DefaultPolicy: workcalendar.PolicyPrevious,
+		TeamPolicies:  map[string]string{"sales": workcalendar.PolicyNext, "ops": workcalendar.PolicyNone},
+	}}
+
+	// 11 May 2030 is a Saturday after the 9-10 May holidays.
+	birthday := models.Event{Type: models.EventBirthday, Date: "1990-05-11", Recurrence: models.RecurrenceYearly}
+	leap := models.Event{Type: models.EventBirthday, Date: "2000-02-29", Recurrence: models.RecurrenceYearly}
+	once := models.Event{Type: models.EventBirthday, Date: "2030-05-11", Recurrence: models.RecurrenceOnce}
+
+	tests := []struct {
+		name      string
+		event     models.Event
+		team      string
+		day       string
+		advance   bool
+		wantDate  string
+		wantYears int
+		wantOK    bool
+	}{
+		{name: "moved to the previous working day", event: birthday, day: "2030-05-08", wantDate: "2030-05-11", wantYears: 40, wantOK: true},
+		{name: "not announced on the day off", event: birthday, day: "2030-05-11"},
+		{name: "not announced on a holiday", event: birthday, day: "2030-05-10"},
+		{name: "team moves it to the next working day", event: birthday, team: "sales", day: "2030-05-13", wantDate: "2030-05-11", wantYears: 40, wantOK: true},
+		{name: "team policy replaces the default", event: birthday, team: "sales", day: "2030-05-08"},
+		{name: "team without shifting", event: birthday, team: "ops", day: "2030-05-11", wantDate: "2030-05-11", wantYears: 40, wantOK: true},
+		{name: "advance reminder is not postponed past the event", event: birthday, team: "sales", day: "2030-05-11", advance: true, wantDate: "2030-05-11", wantYears: 40, wantOK: true},
+		{name: "one-off event", event: once, day: "2030-05-08", wantDate: "2030-05-11", wantOK: true},
+		{name: "one-off event in another year", event: once, day: "2031-05-09"},
+		{name: "29 February in a leap year", event: leap, day: "2028-02-29", wantDate: "2028-02-29", wantYears: 28, wantOK: true},
+		{name: "28 February stands in for 29 February", event: leap, day: "2029-02-28", wantDate: "2029-02-28", wantYears: 29, wantOK: true},
+		{name: "28 February of a leap year", event: leap, day: "2028-02-28"},
+		{name: "28 February on a Sunday is moved", event: leap, day: "2027-02-26", wantDate: "2027-02-28", wantYears: 27, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, years, ok := uc.occurrenceAnnouncedOn(tt.event, tt.team, day(tt.day), tt.advance)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got := date.Format("2006-01-02"); got != tt.wantDate || years != tt.wantYears {
+				t.Errorf("got %s, %d years; want %s, %d years", got, years, tt.wantDate, tt.wantYears)
+			}
+		})
+	}
+}
+
+func TestOccurrenceAnnouncedOnWithoutCalendar(t *testing.T) {
+	uc := &UseCase{reminders: ReminderOptions{DefaultPolicy: workcalendar.PolicyPrevious}}
+	birthday := models.Event{Type: models.EventBirthday, Date: "1990-05-11", Recurrence: models.RecurrenceYearly}
+
+	if _, _, ok := uc.occurrenceAnnouncedOn(birthday, "", day("2030-05-11"), false); !ok {
+		t.Error("event is not announced on its day without a calendar")
+	}
+	if _, _, ok := uc.occurrenceAnnouncedOn(birthday, "", day("2030-05-10"), false); ok {
+		t.Error("event is moved without a calendar")
+	}
+}
@@ -0,0 +1,440 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const callbackSettings = "settings:"
+
+const (
+	maxReminderOffsets = 5
+	maxReminderOffset  = 60
+)
+
+const settingsHelp = "Настройки можно менять кнопками или командами:\n" +
+	"/settings lang ru|en - язык напоминаний\n" +
+	"/settings tz <зона> - часовой пояс, например Europe/Moscow\n" +
+	"/settings hour <0-23>|default - с какого часа присылать напоминания\n" +
+	"/settings offsets <1,7>|none|default - за сколько дней напоминать заранее\n" +
+	"/settings digest weekly|monthly|both|off - сводка вместо отдельных напоминаний\n" +
+	"/settings privacy public|subscribers|private - кому видны ваши даты\n" +
+	"/settings quiet <22-8>|off - тихие часы\n" +
+	"/vacation <с> <по>|off - отпуск без уведомлений"
+
+// Menu presets the buttons cycle through; other values are set with commands.
+var (
+	timeZonePresets = []string{"", "Europe/Kaliningrad", "Europe/Moscow", "Europe/Samara", "Asia/Yekaterinburg",
+		"Asia/Omsk", "Asia/Novosibirsk", "Asia/Krasnoyarsk", "Asia/Irkutsk", "Asia/Yakutsk",
+		"Asia/Vladivostok", "Asia/Magadan", "Asia/Kamchatka"}
+	offsetPresets  = [][]int{{}, {1}, {3}, {7}, {1, 7}, {3, 14}}
+	quietPresets   = [][2]int{{0, 0}, {22, 8}, {23, 9}, {21, 9}}
+	privacyPresets = []string{models.VisibilityPublic, models.VisibilitySubscribers, models.VisibilityPrivate}
+)
+
+// tr picks the text for the user's language; Russian is the default.
+func tr(lang, ru, en string) string {
+	if lang == models.LanguageEnglish {
+		return en
+	}
+	return ru
+}
+
+// defaultLocation is the time zone of users who have not chosen their own.
+func (uc *UseCase) defaultLocation() *time.Location {
+	if uc.reminders.Location != nil {
+		return uc.reminders.Location
+	}
+	return time.Local
+}
+
+// effectiveSettings fills in the values that follow the bot's configuration.
+func (uc *UseCase) effectiveSettings(settings models.Settings) models.Settings {
+	if settings.Language == "" {
+		settings.Language = models.LanguageRussian
+	}
+	if settings.Privacy == "" {
+		settings.Privacy = models.VisibilityPublic
+	}
+	if settings.NotifyHour < 0 {
+		settings.NotifyHour = uc.reminders.Hour
+	}
+	if settings.ReminderOffsets == nil {
+		settings.ReminderOffsets = []int{}
+		if uc.reminders.DaysBefore > 0 {
+			settings.ReminderOffsets = []int{uc.reminders.DaysBefore}
+		}
+	}
+	return settings
+}
+
+// Settings handles /settings: without arguments it shows the menu.
+func (uc *UseCase) Settings(ctx context.Context, id int, param string) error {
+	fields := strings.Fields(param)
+	if len(fields) == 0 {
+		return uc.showSettings(ctx, id, 0)
+	}
+	if len(fields) != 2 {
+		return uc.tg.Response(ctx, int64(id), settingsHelp)
+	}
+
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сначала отправьте /start")
+	}
+
+	settings, err := uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+
+	value := fields[1]
+	ok := true
+	switch strings.ToLower(fields[0]) {
+	case "lang":
+		ok = setLanguage(&settings, strings.ToLower(value))
+	case "tz":
+		ok = setTimeZone(&settings, value)
+	case "hour":
+		ok = setNotifyHour(&settings, strings.ToLower(value))
+	case "offsets":
+		ok = setReminderOffsets(&settings, strings.ToLower(value))
+	case "digest":
+		ok = setDigest(&settings, strings.ToLower(value))
+	case "privacy":
+		ok = setPrivacy(&settings, strings.ToLower(value))
+	case "quiet":
+		ok = setQuietHours(&settings, strings.ToLower(value))
+	default:
+		ok = false
+	}
+	if !ok {
+		return uc.tg.Response(ctx, int64(id), settingsHelp)
+	}
+
+	if err := uc.saveSettings(ctx, settings); err != nil {
+		return err
+	}
+	return uc.showSettings(ctx, id, 0)
+}
+
+// settingsCallback applies a menu button and redraws the menu in place.
+func (uc *UseCase) settingsCallback(ctx context.Context, id int, messageID int, action string) error {
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.replyTo(ctx, id, messageID, "Сначала отправьте /start")
+	}
+
+	settings, err := uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+	current := uc.effectiveSettings(settings)
+
+	switch action {
+	case "lang":
+		settings.Language = tr(current.Language, models.LanguageEnglish, models.LanguageRussian)
+	case "tz":
+		settings.TimeZone = nextPreset(timeZonePresets, settings.TimeZone)
+	case "hour:-1":
+		settings.NotifyHour = (current.NotifyHour + 23) % 24
+	case "hour:+1":
+		settings.NotifyHour = (current.NotifyHour + 1) % 24
+	case "offsets":
+		settings.ReminderOffsets = offsetPresets[0]
+		for i, preset := range offsetPresets {
+			if equalOffsets(preset, current.ReminderOffsets) {
+				settings.ReminderOffsets = offsetPresets[(i+1)%len(offsetPresets)]
+			}
+		}
+	case "digest":
+		// off -> weekly -> monthly -> both -> off
+		switch {
+		case settings.DigestWeekly && settings.DigestMonthly:
+			settings.DigestWeekly, settings.DigestMonthly = false, false
+		case settings.DigestWeekly:
+			settings.DigestWeekly, settings.DigestMonthly = false, true
+		case settings.DigestMonthly:
+			settings.DigestWeekly, settings.DigestMonthly = true, true
+		default:
+			settings.DigestWeekly = true
+		}
+	case "privacy":
+		settings.Privacy = nextPreset(privacyPresets, current.Privacy)
+	case "quiet":
+		next := quietPresets[0]
+		for i, preset := range quietPresets {
+			if preset == [2]int{settings.QuietFrom, settings.QuietTo} {
+				next = quietPresets[(i+1)%len(quietPresets)]
+			}
+		}
+		settings.QuietFrom, settings.QuietTo = next[0], next[1]
+	default:
+		return nil
+	}
+
+	if err := uc.saveSettings(ctx, settings); err != nil {
+		return err
+	}
+	return uc.showSettings(ctx, id, messageID)
+}
+
+// saveSettings also carries a privacy change over to the user's events that
+// still follow the old default; a visibility chosen with /event set is kept.
+func (uc *UseCase) saveSettings(ctx context.Context, settings models.Settings) error {
+	previous, err := uc.db.GetSettings(ctx, settings.TelegramID)
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+
+	err = uc.db.SaveSettings(ctx, settings)
+	if err != nil {
+		return fmt.Errorf("error saving settings: %w", err)
+	}
+
+	from, to := uc.effectiveSettings(previous).Privacy, uc.effectiveSettings(settings).Privacy
+	if from != to {
+		err = uc.db.SetEventsVisibility(ctx, settings.TelegramID, from, to)
+		if err != nil {
+			return fmt.Errorf("error updating events visibility: %w", err)
+		}
+	}
+	return nil
+}
+
+// showSettings sends the menu, or redraws it when messageID is set.
+func (uc *UseCase) showSettings(ctx context.Context, id int, messageID int) error {
+	settings, err := uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+
+	text, rows := uc.settingsMenu(settings)
+	if messageID == 0 {
+		return uc.tg.SendMenu(ctx, int64(id), text, rows)
+	}
+	return uc.tg.EditMenu(ctx, int64(id), messageID, text, rows)
+}
+
+func (uc *UseCase) settingsMenu(stored models.Settings) (string, [][]models.Button) {
+	s := uc.effectiveSettings(stored)
+	lang := s.Language
+
+	timeZone := s.TimeZone
+	if timeZone == "" {
+		timeZone = tr(lang, "по умолчанию", "default") + " (" + uc.defaultLocation().String() + ")"
+	}
+
+	offsets := tr(lang, "не напоминать", "none")
+	if len(s.ReminderOffsets) > 0 {
+		days := make([]string, len(s.ReminderOffsets))
+		for i, offset := range s.ReminderOffsets {
+			days[i] = strconv.Itoa(offset)
+		}
+		offsets = tr(lang, "за ", "") + strings.Join(days, ", ") + tr(lang, " дн.", " days before")
+	}
+
+	var digest string
+	switch {
+	case s.DigestWeekly && s.DigestMonthly:
+		digest = tr(lang, "сводка по понедельникам и первого числа", "weekly and monthly digest")
+	case s.DigestWeekly:
+		digest = tr(lang, "сводка по понедельникам", "weekly digest")
+	case s.DigestMonthly:
+		digest = tr(lang, "сводка первого числа", "monthly digest")
+	default:
+		digest = tr(lang, "о каждом событии", "every event")
+	}
+
+	var privacy string
+	switch s.Privacy {
+	case models.VisibilitySubscribers:
+		privacy = tr(lang, "подписчикам", "subscribers")
+	case models.VisibilityPrivate:
+		privacy = tr(lang, "только вам", "only you")
+	default:
+		privacy = tr(lang, "всем", "everyone")
+	}
+
+	quiet := tr(lang, "нет", "off")
+	if s.QuietFrom != s.QuietTo {
+		quiet = fmt.Sprintf("%d:00–%d:00", s.QuietFrom, s.QuietTo)
+	}
+
+	vacation := tr(lang, "нет", "off")
+	if s.VacationTo != "" {
+		vacation = vacationRange(s)
+	}
+
+	text := strings.Join([]string{
+		tr(lang, "Настройки", "Settings"),
+		tr(lang, "Язык: русский", "Language: English"),
+		tr(lang, "Часовой пояс: ", "Time zone: ") + timeZone,
+		fmt.Sprintf(tr(lang, "Напоминания с %d:00", "Reminders from %d:00"), s.NotifyHour),
+		tr(lang, "Заранее: ", "In advance: ") + offsets,
+		tr(lang, "Доставка: ", "Delivery: ") + digest,
+		tr(lang, "Ваши даты видны: ", "Your dates are visible to: ") + privacy,
+		tr(lang, "Тихие часы: ", "Quiet hours: ") + quiet,
+		tr(lang, "Отпуск: ", "Vacation: ") + vacation,
+		"",
+		tr(lang, "/settings help - текстовые команды", "/settings help - text commands"),
+	}, "\n")
+
+	rows := [][]models.Button{
+		{
+			{Text: tr(lang, "🌐 English", "🌐 Русский"), Data: callbackSettings + "lang"},
+			{Text: "🕘 " + timeZone, Data: callbackSettings + "tz"},
+		},
+		{
+			{Text: tr(lang, "⏰ −1 ч", "⏰ −1 h"), Data: callbackSettings + "hour:-1"},
+			{Text: tr(lang, "⏰ +1 ч", "⏰ +1 h"), Data: callbackSettings + "hour:+1"},
+		},
+		{{Text: tr(lang, "📅 Заранее: ", "📅 In advance: ") + offsets, Data: callbackSettings + "offsets"}},
+		{{Text: tr(lang, "📰 Доставка: ", "📰 Delivery: ") + digest, Data: callbackSettings + "digest"}},
+		{{Text: tr(lang, "🔒 Видны: ", "🔒 Visible to: ") + privacy, Data: callbackSettings + "privacy"}},
+		{{Text: tr(lang, "🌙 Тихие часы: ", "🌙 Quiet hours: ") + quiet, Data: callbackSettings + "quiet"}},
+	}
+	return text, rows
+}
+
+func setLanguage(settings *models.Settings, value string) bool {
+	if value != models.LanguageRussian && value != models.LanguageEnglish {
+		return false
+	}
+	settings.Language = value
+	return true
+}
+
+func setTimeZone(settings *models.Settings, value string) bool {
+	if strings.EqualFold(value, "default") {
+		settings.TimeZone = ""
+		return true
+	}
+	if _, err := time.LoadLocation(value); err != nil || value == "" || strings.EqualFold(value, "local") {
+		return false
+	}
+	settings.TimeZone = value
+	return true
+}
+
+func setNotifyHour(settings *models.Settings, value string) bool {
+	if value == "default" {
+		settings.NotifyHour = -1
+		return true
+	}
+	hour, err := strconv.Atoi(value)
+	if err != nil || hour < 0 || hour > 23 {
+		return false
+	}
+	settings.NotifyHour = hour
+	return true
+}
+
+func setReminderOffsets(settings *models.Settings, value string) bool {
+	switch value {
+	case "default":
+		settings.ReminderOffsets = nil
+		return true
+	case "none", "off":
+		settings.ReminderOffsets = []int{}
+		return true
+	}
+
+	seen := make(map[int]bool)
+	offsets := []int{}
+	for _, part := range strings.Split(value, ",") {
+		offset, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || offset < 1 || offset > maxReminderOffset {
+			return false
+		}
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+	if len(offsets) > maxReminderOffsets {
+		return false
+	}
+	sort.Ints(offsets)
+	settings.ReminderOffsets = offsets
+	return true
+}
+
+func setDigest(settings *models.Settings, value string) bool {
+	switch value {
+	case "weekly":
+		settings.DigestWeekly, settings.DigestMonthly = true, false
+	case "monthly":
+		settings.DigestWeekly, settings.DigestMonthly = false, true
+	case "both":
+		settings.DigestWeekly, settings.DigestMonthly = true, true
+	case "off":
+		settings.DigestWeekly, settings.DigestMonthly = false, false
+	default:
+		return false
+	}
+	return true
+}
+
+func setPrivacy(settings *models.Settings, value string) bool {
+	for _, preset := range privacyPresets {
+		if value == preset {
+			settings.Privacy = value
+			return true
+		}
+	}
+	return false
+}
+
+func setQuietHours(settings *models.Settings, value string) bool {
+	if value == "off" {
+		settings.QuietFrom, settings.QuietTo = 0, 0
+		return true
+	}
+	fromParam, toParam, ok := strings.Cut(value, "-")
+	if !ok {
+		return false
+	}
+	from, err := strconv.Atoi(fromParam)
+	if err != nil || from < 0 || from > 23 {
+		return false
+	}
+	to, err := strconv.Atoi(toParam)
+	if err != nil || to < 0 || to > 23 {
+		return false
+	}
+	settings.QuietFrom, settings.QuietTo = from, to
+	return true
+}
+
+func nextPreset(presets []string, current string) string {
+	for i, preset := range presets {
+		if preset == current {
+			return presets[(i+1)%len(presets)]
+		}
+	}
+	return presets[0]
+}
+
+func equalOffsets(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"reflect"
+	"testing"
+
+	"rutube/models"
+)
+
+func TestSetReminderOffsets(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+		want  []int
+	}{
+		{"3", true, []int{3}},
+		{"7,1,3", true, []int{1, 3, 7}},
+		{"1, 7", true, []int{1, 7}},
+		{"7,1,7,1", true, []int{1, 7}},
+		{"1,2,3,4,5", true, []int{1, 2, 3, 4, 5}},
+		{"1,2,3,4,5,5", true, []int{1, 2, 3, 4, 5}},
+		{"60", true, []int{60}},
+		{"default", true, nil},
+		{"none", true, []int{}},
+		{"off", true, []int{}},
+		{"1,2,3,4,5,6", false, []int{2}},
+		{"0", false, []int{2}},
+		{"-1", false, []int{2}},
+		{"61", false, []int{2}},
+		{"1,,2", false, []int{2}},
+		{"1;2", false, []int{2}},
+		{"x", false, []int{2}},
+		{"", false, []int{2}},
+	}
+
+	for _, tt := range tests {
+		settings := models.Settings{ReminderOffsets: []int{2}}
+		if ok := setReminderOffsets(&settings, tt.value); ok != tt.ok {
+			t.Errorf("setReminderOffsets(%q) = %v, want %v", tt.value, ok, tt.ok)
+		}
+		if !reflect.DeepEqual(settings.ReminderOffsets, tt.want) {
+			t.Errorf("setReminderOffsets(%q) left %#v, want %#v", tt.value, settings.ReminderOffsets, tt.want)
+		}
+	}
+}
+
+func TestSetQuietHours(t *testing.T) {
+	tests := []struct {
+		value    string
+		ok       bool
+		from, to int
+	}{
+		{"22-8", true, 22, 8},
+		{"0-7", true, 0, 7},
+		{"23-0", true, 23, 0},
+		{"9-9", true, 9, 9},
+		{"off", true, 0, 0},
+		{"24-8", false, 1, 2},
+		{"22-24", false, 1, 2},
+		{"-1-8", false, 1, 2},
+		{"22--8", false, 1, 2},
+		{"22", false, 1, 2},
+		{"22-", false, 1, 2},
+		{"-8", false, 1, 2},
+		{"a-b", false, 1, 2},
+		{"22:00-8:00", false, 1, 2},
+		{"", false, 1, 2},
+	}
+
+	for _, tt := range tests {
+		settings := models.Settings{QuietFrom: 1, QuietTo: 2}
+		if ok := setQuietHours(&settings, tt.value); ok != tt.ok {
+			t.Errorf("setQuietHours(%q) = %v, want %v", tt.value, ok, tt.ok)
+		}
+		if settings.QuietFrom != tt.from || settings.QuietTo != tt.to {
+			t.Errorf("setQuietHours(%q) left %d-%d, want %d-%d", tt.value, settings.QuietFrom, settings.QuietTo, tt.from, tt.to)
+		}
+	}
+}
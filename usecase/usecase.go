@@ -1,52 +1,132 @@
 package usecase
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	telegramconnect "rutube/infrastructure/TelegramConnect"
 	"rutube/infrastructure/database"
+	"rutube/infrastructure/workcalendar"
 	"rutube/models"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type UseCase struct {
-	Logger *zap.Logger
-	db     *database.Database
-	tg     *telegramconnect.TelegramClient
+	Logger    *zap.Logger
+	db        *database.Database
+	tg        *telegramconnect.TelegramClient
+	admins    map[int64]bool
+	publicURL string
+	reminders ReminderOptions
+
+	forgetMu       sync.Mutex
+	forgetRequests map[int]time.Time
+}
+
+type Options struct {
+	AdminIDs  []int64
+	PublicURL string
+	Reminders ReminderOptions
 }
 
-func NewUseCase(logger *zap.Logger, db *database.Database, tg *telegramconnect.TelegramClient) *UseCase {
+type ReminderOptions struct {
+	// Hour is the local hour from which reminders for the day are queued.
+	Hour int
+	// DaysBefore adds an advance reminder; zero sends only on the day.
+	DaysBefore int
+	// Calendar moves announcements off days off according to the policy of
+	// the person's team, or DefaultPolicy; nil disables shifting.
+	Calendar      *workcalendar.Calendar
+	DefaultPolicy string
+	TeamPolicies  map[string]string
+	// Location is the time zone of users who have not chosen one; nil means
+	// the server's zone. The outbox sender uses the same for quiet hours.
+	Location *time.Location
+}
+
+func NewUseCase(logger *zap.Logger, db *database.Database, tg *telegramconnect.TelegramClient, opts Options) *UseCase {
+	admins := make(map[int64]bool, len(opts.AdminIDs))
+	for _, id := range opts.AdminIDs {
+		admins[id] = true
+	}
+
 	return &UseCase{
-		Logger: logger,
-		db:     db,
-		tg:     tg,
+		Logger:    logger,
+		db:        db,
+		tg:        tg,
+		admins:    admins,
+		publicURL: opts.PublicURL,
+		reminders: opts.Reminders,
+
+		forgetRequests: make(map[int]time.Time),
 	}
 }
 
-func (uc *UseCase) StartCase(firstName string, lastName string, id int) error {
+func (uc *UseCase) StartCase(ctx context.Context, firstName string, lastName string, username string, id int) error {
 	var userInfo models.ShortUserInfo
 
-	userInfo, err := uc.db.FindUserByID(id)
+	userInfo, err := uc.db.FindUserByID(ctx, id)
 	if err != nil {
 		uc.Logger.Error("Error while querying the database", zap.Error(err))
 		return err
 	}
 
+	username = normalizeUsername(username)
+	if userInfo == (models.ShortUserInfo{}) && username != "" {
+		userInfo, err = uc.db.FindUserByUsername(ctx, username)
+		if err != nil {
+			uc.Logger.Error("Error while querying the database", zap.Error(err))
+			return err
+		}
+
+		if userInfo.ID != 0 {
+			linked, err := uc.db.LinkTelegramID(ctx, userInfo.ID, id)
+			if err != nil {
+				uc.Logger.Error("Error while linking imported user", zap.Error(err))
+				return err
+			}
+			if !linked {
+				// The username belongs to another account, so it cannot be ours.
+				uc.Logger.Warn("Username is taken by another account", zap.Int("telegram_id", id))
+				userInfo = models.ShortUserInfo{}
+				username = ""
+			}
+		}
+
+		if userInfo.ID != 0 {
+			userInfo.IDTG = id
+
+			text := fmt.Sprintf("Добро пожаловать в бота, %s %s! Ваши данные уже были добавлены администратором.\n/help - все доступные команды\n/allUser - все коллеги", firstName, lastName)
+			uc.tg.Response(ctx, int64(id), text)
+		}
+	}
+
+	if userInfo.Inactive {
+		_, err = uc.db.SetUserActive(ctx, id, true)
+		if err != nil {
+			uc.Logger.Error("Error while reactivating user", zap.Error(err))
+			return err
+		}
+		uc.Logger.Info("User reactivated", zap.Int("telegram_id", id))
+	}
+
 	if userInfo == (models.ShortUserInfo{}) {
 		text := fmt.Sprintf("Добро пожаловать в бота, %s %s, который позволит отслеживать дни рождения ваших коллег.\n/help - все доступные команды\n/allUser - все коллеги", firstName, lastName)
-		uc.tg.Response(int64(id), text)
+		uc.tg.Response(ctx, int64(id), text)
 
 		newUser := models.ShortUserInfo{
 			IDTG:      id,
 			FirstName: firstName,
 			LastName:  lastName,
 			BirthDate: "",
+			Username:  username,
 		}
-		err := uc.db.InsertUser(newUser)
+		err := uc.db.InsertUser(ctx, newUser)
 		if err != nil {
 			uc.Logger.Error("Error while adding new user to the database", zap.Error(err))
 			return err
@@ -56,7 +136,7 @@ func (uc *UseCase) StartCase(firstName string, lastName string, id int) error {
 	}
 
 	if userInfo.BirthDate == "" {
-		chat, err := uc.tg.GetUserInfo(int64(id))
+		chat, err := uc.tg.GetUserInfo(ctx, int64(id))
 		if err != nil {
 			uc.Logger.Error("The telegram request was not made correctly", zap.Error(err))
 			return err
@@ -65,17 +145,13 @@ func (uc *UseCase) StartCase(firstName string, lastName string, id int) error {
 		birthDate, err := findAndFormatDate(chat.Bio)
 		if err != nil {
 			text := "Мы не нашли информацию о вашем дне рождении в Вашем Био"
-			uc.tg.Response(int64(id), text)
-			uc.RequestBirthDate(int64(id))
+			uc.tg.Response(ctx, int64(id), text)
+			uc.RequestBirthDate(ctx, int64(id))
 			uc.Logger.Error("Error parsing text or date was not found", zap.Error(err))
 		} else {
-			err = uc.db.UpdateUserBirthDate(id, birthDate)
-
-			text := "Мы нашли информацию о вашем дне рождении в Вашем Био, надеемся она верная!"
-			uc.tg.Response(int64(id), text)
-
+			err = uc.proposeBirthday(ctx, id, birthDate, models.BirthdaySourceBio)
 			if err != nil {
-				uc.Logger.Error("Error while updating user birth date in the database", zap.Error(err))
+				uc.Logger.Error("Error while asking to confirm birth date", zap.Error(err))
 				return err
 			}
 		}
@@ -84,6 +160,29 @@ func (uc *UseCase) StartCase(firstName string, lastName string, id int) error {
 	return nil
 }
 
+// ChatMemberUpdated follows the user blocking ("kicked") or unblocking
+// ("member") the bot in the private chat.
+func (uc *UseCase) ChatMemberUpdated(ctx context.Context, id int, status string) error {
+	var active bool
+	switch status {
+	case "kicked":
+		active = false
+	case "member":
+		active = true
+	default:
+		return nil
+	}
+
+	changed, err := uc.db.SetUserActive(ctx, id, active)
+	if err != nil {
+		return fmt.Errorf("error updating user status: %w", err)
+	}
+	if changed {
+		uc.Logger.Info("User status changed", zap.Int("telegram_id", id), zap.Bool("active", active))
+	}
+	return nil
+}
+
 var datePatterns = []string{
 	`(\d{2})[/-](\d{2})[/-](\d{4})`,
 	`(\d{4})[/-](\d{2})[/-](\d{2})`,
@@ -112,58 +211,89 @@ func findAndFormatDate(input string) (string, error) {
 	return "", fmt.Errorf("no valid date found")
 }
 
-func (uc *UseCase) RequestBirthDate(userID int64) error {
+func (uc *UseCase) RequestBirthDate(ctx context.Context, userID int64) error {
 	text := "Пожалуйста, введите вашу дату рождения в формате ДД-ММ-ГГГГ."
-	return uc.tg.Response(userID, text)
+	return uc.tg.Response(ctx, userID, text)
 }
 
-func (uc *UseCase) SetBirthday(date string, id int) error {
+func (uc *UseCase) SetBirthday(ctx context.Context, date string, id int) error {
 	result, err := findAndFormatDate(date)
 	if err != nil {
 		uc.Logger.Error("Invalid date format", zap.Error(err))
 		text := "Пожалуйста, введите вашу дату рождения в формате ДД-ММ-ГГГГ."
-		uc.tg.Response(int64(id), text)
+		uc.tg.Response(ctx, int64(id), text)
 		return err
 	}
-	err = uc.db.UpdateUserBirthDate(id, result)
+	err = uc.db.UpdateUserBirthDate(ctx, id, result, models.BirthdaySourceManual)
 	if err != nil {
 		uc.Logger.Error("Error updating birth date", zap.Error(err))
 		return err
 	}
+	err = uc.db.DeletePendingBirthday(ctx, id)
+	if err != nil {
+		uc.Logger.Error("Error deleting pending birth date", zap.Error(err))
+	}
 	text := "Спасибо. Информация о вас внесена в список."
-	uc.tg.Response(int64(id), text)
+	uc.tg.Response(ctx, int64(id), text)
 	return nil
 }
 
-func (uc *UseCase) SetAllUser(id int) error {
-	users, err := uc.db.SetAllUser()
+func (uc *UseCase) SetAllUser(ctx context.Context, id int) error {
+	users, err := uc.db.SetAllUser(ctx)
 	if err != nil {
 		return err
 	}
 
-	result := JoinUsers(users)
-	uc.tg.Response(int64(id), result)
+	events, err := uc.db.ListEvents(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	result := JoinUsers(users, events)
+	uc.tg.Response(ctx, int64(id), result)
 	return nil
 }
 
-func JoinUsers(users []models.ShortUserInfo) string {
+// JoinUsers lists the users with their public events; a birthday that is not
+// public is left blank.
+func JoinUsers(users []models.ShortUserInfo, events []models.Event) string {
+	public := make(map[int][]models.Event)
+	for _, event := range events {
+		if event.Visibility == models.VisibilityPublic {
+			public[event.UserID] = append(public[event.UserID], event)
+		}
+	}
+
 	var sb strings.Builder
 
 	for _, user := range users {
-		sb.WriteString(fmt.Sprintf("ID: %d, TelegramID: %d, FirstName: %s, LastName: %s, BirthDate: %s\n",
-			user.ID, user.IDTG, user.FirstName, user.LastName, user.BirthDate))
+		birthDate := ""
+		var other strings.Builder
+		for _, event := range public[user.ID] {
+			if event.Type == models.EventBirthday {
+				birthDate = event.Date
+				continue
+			}
+			other.WriteString(fmt.Sprintf(", %s: %s", event.Type, event.Date))
+		}
+		sb.WriteString(fmt.Sprintf("ID: %d, TelegramID: %d, FirstName: %s, LastName: %s, BirthDate: %s%s\n",
+			user.ID, user.IDTG, user.FirstName, user.LastName, birthDate, other.String()))
 	}
 
 	return sb.String()
 }
 
-func (uc *UseCase) SetSub(id int, idSub string) error {
-	subscriberID, err := strconv.ParseInt(idSub, 10, 64)
+// SetSub toggles the subscription to a colleague. With an event type after
+// the id it toggles only that type, keeping the subscription while at least
+// one type is left.
+func (uc *UseCase) SetSub(ctx context.Context, id int, idSub string) error {
+	idParam, typeParam, _ := strings.Cut(strings.TrimSpace(idSub), " ")
+	subscriberID, err := strconv.ParseInt(idParam, 10, 64)
 	if err != nil {
 		return fmt.Errorf("invalid id: %w", err)
 	}
 
-	user, err := uc.db.FindUserByID(int(subscriberID))
+	user, err := uc.db.FindUserByID(ctx, int(subscriberID))
 	if err != nil {
 		return fmt.Errorf("error finding user: %w", err)
 	}
@@ -171,22 +301,93 @@ func (uc *UseCase) SetSub(id int, idSub string) error {
 		return fmt.Errorf("user not found")
 	}
 
-	subscribed, err := uc.db.IsSubscribed(int64(id), subscriberID)
+	if typeParam = strings.TrimSpace(typeParam); typeParam != "" {
+		eventType, ok := parseEventType(typeParam)
+		if !ok {
+			return uc.tg.Response(ctx, int64(id), "Неизвестный тип даты. Типы: birthday, anniversary, nameday")
+		}
+		return uc.toggleEventType(ctx, int64(id), subscriberID, eventType)
+	}
+
+	subscribed, err := uc.db.IsSubscribed(ctx, int64(id), subscriberID)
 	if err != nil {
 		return fmt.Errorf("error checking subscription: %w", err)
 	}
 
 	if subscribed {
-		err := uc.db.UnsubscribeFromBirthday(int64(id), subscriberID)
+		err := uc.db.UnsubscribeFromBirthday(ctx, int64(id), subscriberID)
 		if err != nil {
 			return fmt.Errorf("error unsubscribing: %w", err)
 		}
 	} else {
-		err := uc.db.SubscribeToBirthday(int64(id), subscriberID)
+		err := uc.db.SubscribeToBirthday(ctx, int64(id), subscriberID)
+		if err != nil {
+			return fmt.Errorf("error subscribing: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (uc *UseCase) toggleEventType(ctx context.Context, subscriberID, subscribedToID int64, eventType string) error {
+	subscriptions, err := uc.db.ListSubscriptions(ctx, subscriberID)
+	if err != nil {
+		return fmt.Errorf("error listing subscriptions: %w", err)
+	}
+
+	var current *models.Subscription
+	for i := range subscriptions {
+		if subscriptions[i].SubscribedToID == subscribedToID {
+			current = &subscriptions[i]
+		}
+	}
+
+	if current == nil {
+		err := uc.db.SubscribeToBirthday(ctx, subscriberID, subscribedToID)
 		if err != nil {
 			return fmt.Errorf("error subscribing: %w", err)
 		}
+		return uc.setEventTypes(ctx, subscriberID, subscribedToID, []string{eventType})
+	}
+
+	covered := current.EventTypes
+	if len(covered) == 0 {
+		covered = models.EventTypes
+	}
+
+	var types []string
+	found := false
+	for _, t := range covered {
+		if t == eventType {
+			found = true
+			continue
+		}
+		types = append(types, t)
+	}
+	if !found {
+		types = append(types, eventType)
+	}
+
+	if len(types) == 0 {
+		err := uc.db.UnsubscribeFromBirthday(ctx, subscriberID, subscribedToID)
+		if err != nil {
+			return fmt.Errorf("error unsubscribing: %w", err)
+		}
+		return nil
+	}
+	return uc.setEventTypes(ctx, subscriberID, subscribedToID, types)
+}
+
+// setEventTypes stores an empty list when every type is selected, so the
+// subscription also covers types added later.
+func (uc *UseCase) setEventTypes(ctx context.Context, subscriberID, subscribedToID int64, types []string) error {
+	if len(types) == len(models.EventTypes) {
+		types = nil
 	}
 
+	err := uc.db.SetSubscriptionEventTypes(ctx, subscriberID, subscribedToID, types)
+	if err != nil {
+		return fmt.Errorf("error updating subscription: %w", err)
+	}
 	return nil
 }
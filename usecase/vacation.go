@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"rutube/models"
+	"strings"
+	"time"
+)
+
+const vacationHelp = "Отпуск без уведомлений:\n" +
+	"/vacation <ГГГГ-ММ-ДД> <ГГГГ-ММ-ДД> - с какого по какой день не беспокоить\n" +
+	"/vacation off - отменить\n" +
+	"Всё, что придёт за это время, вы получите одним сообщением после отпуска."
+
+// Vacation handles /vacation. The outbox sender holds notifications back
+// during the vacation, as during quiet hours.
+func (uc *UseCase) Vacation(ctx context.Context, id int, param string) error {
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сначала отправьте /start")
+	}
+
+	settings, err := uc.db.GetSettings(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error reading settings: %w", err)
+	}
+	lang := uc.effectiveSettings(settings).Language
+
+	fields := strings.Fields(param)
+	switch {
+	case len(fields) == 0:
+		if settings.VacationTo == "" {
+			return uc.tg.Response(ctx, int64(id), tr(lang, "Отпуск не задан.", "No vacation set.")+"\n\n"+vacationHelp)
+		}
+		return uc.tg.Response(ctx, int64(id), tr(lang, "Отпуск: ", "Vacation: ")+vacationRange(settings))
+	case len(fields) == 1 && strings.ToLower(fields[0]) == "off":
+		settings.VacationFrom, settings.VacationTo = "", ""
+	case len(fields) == 2:
+		from, err := findAndFormatDate(fields[0])
+		if err != nil {
+			return uc.tg.Response(ctx, int64(id), vacationHelp)
+		}
+		to, err := findAndFormatDate(fields[1])
+		if err != nil {
+			return uc.tg.Response(ctx, int64(id), vacationHelp)
+		}
+		if to < from {
+			return uc.tg.Response(ctx, int64(id), tr(lang, "Отпуск не может закончиться раньше, чем начнётся.", "A vacation cannot end before it starts."))
+		}
+		today := time.Now().In(settings.Location(uc.defaultLocation())).Format("2006-01-02")
+		if to < today {
+			return uc.tg.Response(ctx, int64(id), tr(lang, "Этот отпуск уже закончился.", "This vacation is already over."))
+		}
+		settings.VacationFrom, settings.VacationTo = from, to
+	default:
+		return uc.tg.Response(ctx, int64(id), vacationHelp)
+	}
+
+	if err := uc.saveSettings(ctx, settings); err != nil {
+		return err
+	}
+
+	if settings.VacationTo == "" {
+		return uc.tg.Response(ctx, int64(id), tr(lang, "Отпуск отменён.", "Vacation cancelled."))
+	}
+	return uc.tg.Response(ctx, int64(id), fmt.Sprintf(tr(lang,
+		"Отпуск: %s. Уведомления за это время придут одним сообщением после него.",
+		"Vacation: %s. Notifications from this time will arrive in one message afterwards."),
+		vacationRange(settings)))
+}
+
+func vacationRange(settings models.Settings) string {
+	from, _ := time.Parse("2006-01-02", settings.VacationFrom)
+	to, _ := time.Parse("2006-01-02", settings.VacationTo)
+	return from.Format("02.01.2006") + "–" + to.Format("02.01.2006")
+}
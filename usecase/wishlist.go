@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"rutube/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxWishlistItems = 10
+	maxWishlistText  = 200
+)
+
+const wishlistHelp = "Список желаний:\n" +
+	"/wishlist - ваш список\n" +
+	"/wishlist add <текст или ссылка> - добавить\n" +
+	"/wishlist remove <номер> - удалить\n" +
+	"/wishlist list <TelegramID> - список коллеги, на которого вы подписаны"
+
+// Wishlist handles /wishlist. A user's list is shown to themselves and to
+// their subscribers, the same people who get reminders about their birthday.
+func (uc *UseCase) Wishlist(ctx context.Context, id int, param string) error {
+	command, rest, _ := strings.Cut(strings.TrimSpace(param), " ")
+	rest = strings.TrimSpace(rest)
+
+	switch {
+	case command == "" || (command == "list" && rest == ""):
+		return uc.showWishlist(ctx, id, int64(id))
+	case command == "list":
+		ownerID, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return uc.tg.Response(ctx, int64(id), wishlistHelp)
+		}
+		return uc.showWishlist(ctx, id, ownerID)
+	case command == "add" && rest != "":
+		return uc.addWishlistItem(ctx, id, rest)
+	case command == "remove" && rest != "":
+		return uc.removeWishlistItem(ctx, id, rest)
+	default:
+		return uc.tg.Response(ctx, int64(id), wishlistHelp)
+	}
+}
+
+func (uc *UseCase) showWishlist(ctx context.Context, id int, ownerID int64) error {
+	if ownerID != int64(id) {
+		subscribed, err := uc.db.IsSubscribed(ctx, int64(id), ownerID)
+		if err != nil {
+			return fmt.Errorf("error checking subscription: %w", err)
+		}
+		if !subscribed {
+			return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Список желаний виден только подписчикам: /sub %d", ownerID))
+		}
+	}
+
+	items, err := uc.db.ListWishlist(ctx, ownerID)
+	if err != nil {
+		return fmt.Errorf("error listing wishlist: %w", err)
+	}
+
+	if len(items) == 0 {
+		if ownerID == int64(id) {
+			return uc.tg.Response(ctx, int64(id), "Ваш список желаний пуст.\n\n"+wishlistHelp)
+		}
+		return uc.tg.Response(ctx, int64(id), "Список желаний коллеги пуст.")
+	}
+	return uc.tg.Response(ctx, int64(id), formatWishlist(items))
+}
+
+func (uc *UseCase) addWishlistItem(ctx context.Context, id int, text string) error {
+	if utf8.RuneCountInString(text) > maxWishlistText {
+		return uc.tg.Response(ctx, int64(id), fmt.Sprintf("Слишком длинное описание, не больше %d символов.", maxWishlistText))
+	}
+
+	user, err := uc.db.FindUserByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if user.IDTG == 0 {
+		return uc.tg.Response(ctx, int64(id), "Сначала отправьте /start")
+	}
+
+	items, err := uc.db.ListWishlist(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error listing wishlist: %w", err)
+	}
+	if len(items) >= maxWishlistItems {
+		return uc.tg.Response(ctx, int64(id), fmt.Sprintf("В списке уже %d пунктов, удалите что-нибудь: /wishlist remove <номер>", maxWishlistItems))
+	}
+
+	err = uc.db.AddWishlistItem(ctx, models.WishlistItem{TelegramID: int64(id), Text: text, URL: findLink(text)})
+	if err != nil {
+		return fmt.Errorf("error adding wishlist item: %w", err)
+	}
+
+	return uc.tg.Response(ctx, int64(id), "Добавлено. Подписчики увидят список в напоминании перед вашим днём рождения.")
+}
+
+func (uc *UseCase) removeWishlistItem(ctx context.Context, id int, param string) error {
+	number, err := strconv.Atoi(param)
+	if err != nil {
+		return uc.tg.Response(ctx, int64(id), wishlistHelp)
+	}
+
+	items, err := uc.db.ListWishlist(ctx, int64(id))
+	if err != nil {
+		return fmt.Errorf("error listing wishlist: %w", err)
+	}
+	if number < 1 || number > len(items) {
+		return uc.tg.Response(ctx, int64(id), "Нет пункта с таким номером.")
+	}
+
+	_, err = uc.db.RemoveWishlistItem(ctx, int64(id), items[number-1].ID)
+	if err != nil {
+		return fmt.Errorf("error removing wishlist item: %w", err)
+	}
+
+	return uc.tg.Response(ctx, int64(id), "Удалено.")
+}
+
+func formatWishlist(items []models.WishlistItem) string {
+	var sb strings.Builder
+	for i, item := range items {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, item.Text))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// findLink returns the first http(s) link in the text; Telegram makes it
+// clickable in the message, the stored URL is for exports and the API.
+func findLink(text string) string {
+	for _, word := range strings.Fields(text) {
+		link, err := url.Parse(word)
+		if err != nil || link.Host == "" {
+			continue
+		}
+		if link.Scheme == "http" || link.Scheme == "https" {
+			return link.String()
+		}
+	}
+	return ""
+}